@@ -0,0 +1,83 @@
+// Package main реализует утилиту администрирования ключей подписи токенов.
+//
+// Использование:
+//
+//	keyring -f keys.json list            список ключей
+//	keyring -f keys.json rotate          создать новый ключ и сделать его активным
+//	keyring -f keys.json generate        создать новый ключ только для проверки
+//	keyring -f keys.json promote <id>    сделать ключ активным
+//	keyring -f keys.json remove <id>     удалить неактивный ключ
+//
+// Токены, подписанные прежними ключами, продолжают приниматься и перевыпускаются
+// активным ключом. После изменения файла серверу нужно отправить SIGHUP.
+package main
+
+import (
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
+	flag "github.com/spf13/pflag"
+	"os"
+)
+
+func main() {
+	var path string
+	flag.StringVarP(&path, "file", "f", os.Getenv("KEYRING_FILE"), "Путь к файлу с ключами")
+	flag.Parse()
+
+	if path == "" || flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: keyring -f <file> list|rotate|generate|promote <id>|remove <id>")
+		os.Exit(2)
+	}
+
+	err := run(path, flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(path string, args []string) error {
+	k, err := crypt.ReadKeyring(path)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		for _, key := range k.Keys {
+			mark := " "
+			if key.ID == k.Active {
+				mark = "*"
+			}
+			fmt.Printf("%s %s\t%s\n", mark, key.ID, key.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	case "generate", "rotate":
+		key, err := k.Generate()
+		if err != nil {
+			return err
+		}
+		if args[0] == "rotate" {
+			err = k.Promote(key.ID)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Println(key.ID)
+	case "promote", "remove":
+		if len(args) < 2 {
+			return fmt.Errorf("%s: не указан ID ключа", args[0])
+		}
+		if args[0] == "promote" {
+			err = k.Promote(args[1])
+		} else {
+			err = k.Remove(args[1])
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("неизвестная команда: %s", args[0])
+	}
+	return k.Save(path)
+}
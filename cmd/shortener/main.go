@@ -1,14 +1,30 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gerasimovpavel/shortener.git/internal/config"
 	"github.com/gerasimovpavel/shortener.git/internal/deleteuserurl"
+	"github.com/gerasimovpavel/shortener.git/internal/geoip"
+	"github.com/gerasimovpavel/shortener.git/internal/grpcserver"
+	"github.com/gerasimovpavel/shortener.git/internal/handlers"
+	"github.com/gerasimovpavel/shortener.git/internal/middleware"
+	"github.com/gerasimovpavel/shortener.git/internal/policy"
+	"github.com/gerasimovpavel/shortener.git/internal/ratelimit"
 	"github.com/gerasimovpavel/shortener.git/internal/router"
 	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/internal/tracing"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
+	"github.com/gerasimovpavel/shortener.git/internal/users"
+	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
 	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"go.uber.org/zap"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 var (
@@ -25,22 +41,151 @@ func main() {
 	fmt.Printf("Build date: %s\n", buildDate)
 	fmt.Printf("Build commit: %s\n", buildCommit)
 
+	//Парсим переменные и аргументы команднй строки
+	config.ParseEnvFlags()
 	//Logger
-	err = logger.NewLogger()
+	logOpts := logger.Options{
+		Level:          config.Options.LogLevel,
+		Encoding:       config.Options.LogEncoding,
+		Sampling:       config.Options.LogSampling,
+		Outputs:        config.Options.LogOutputs,
+		MaxSize:        config.Options.LogMaxSize,
+		RotateInterval: config.Options.LogRotateInterval,
+		MaxBackups:     config.Options.LogMaxBackups,
+	}
+	log, err := logger.NewLogger(logOpts)
 	if err != nil {
 		panic(err)
 	}
-	//Парсим переменные и аргументы команднй строки
-	config.ParseEnvFlags()
+	defer log.Sync()
+	logger.Logger = log
+	// лог запросов пишем отдельно, если для него заданы свои назначения
+	accessLog := log
+	if len(config.Options.AccessLogOutputs) > 0 {
+		logOpts.Outputs = config.Options.AccessLogOutputs
+		accessLog, err = logger.NewLogger(logOpts)
+		if err != nil {
+			panic(err)
+		}
+		defer accessLog.Sync()
+	}
+	// Трассировка
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	defer shutdownTracing(context.Background())
+	// Ключи подписи токенов, перечитываются по SIGHUP
+	if config.Options.KeyringFile != "" {
+		err = crypt.LoadKeyring(config.Options.KeyringFile)
+		if err != nil {
+			panic(err)
+		}
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				err := crypt.LoadKeyring(config.Options.KeyringFile)
+				if err != nil {
+					log.Error("failed to reload keyring", zap.Error(err))
+					continue
+				}
+				log.Info("keyring reloaded")
+			}
+		}()
+	}
+	if config.Options.PassphraseKey == "" && config.Options.KeyringFile == "" {
+		log.Warn("neither passphrase key nor keyring file is set, using a random signing key: tokens and signed links will not survive restart")
+	}
+	// Перенаправление по умолчанию
+	err = storage.ValidateRedirect(config.Options.RedirectCode, config.Options.RedirectCachePolicy)
+	if err != nil {
+		panic(err)
+	}
+	// Политика адресов назначения, перечитывается при изменении файлов
+	pol, err := policy.Load()
+	if err != nil {
+		panic(err)
+	}
+	policy.Set(pol)
+	if config.Options.PolicyReloadInterval > 0 {
+		go policy.Watch(context.Background(), config.Options.PolicyReloadInterval, log)
+	}
+	// доверенные прокси и база GeoIP для определения страны клиента
+	middleware.TrustedProxies, err = middleware.ParseTrustedProxies(config.Options.TrustedProxies)
+	if err != nil {
+		panic(err)
+	}
+	// подсеть, из которой доступна статистика сервиса
+	if config.Options.TrustedSubnet != "" {
+		_, grpcserver.TrustedSubnet, err = net.ParseCIDR(config.Options.TrustedSubnet)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if config.Options.GeoIPFile != "" {
+		geoip.DB, err = geoip.Open(config.Options.GeoIPFile)
+		if err != nil {
+			panic(err)
+		}
+		defer geoip.DB.Close()
+	}
+	// страница еще не активированной ссылки и запасной адрес сервера
+	if config.Options.ComingSoonFile != "" {
+		err = handlers.LoadComingSoon(config.Options.ComingSoonFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if config.Options.FallbackURL != "" {
+		config.Options.FallbackURL, err = urlnorm.Normalize(config.Options.FallbackURL)
+		if err != nil {
+			panic(err)
+		}
+	}
 	// создаем Storage
 	storage.Stor, err = storage.NewStorage()
 	if err != nil {
 		panic(err)
 	}
+	// индивидуальные квоты ссылок
+	storage.QuotaOverrides, err = storage.ParseQuotaOverrides(config.Options.UserQuotaOverrides)
+	if err != nil {
+		panic(err)
+	}
+	// хранилище зарегистрированных пользователей
+	users.Stor, err = users.NewStorage()
+	if err != nil {
+		panic(err)
+	}
+	defer users.Stor.Close()
+	// ограничение частоты запросов
+	ratelimit.Limits, err = ratelimit.ParseLimits(config.Options.RateLimits)
+	if err != nil {
+		panic(err)
+	}
+	ratelimit.Lim, err = ratelimit.NewLimiter()
+	if err != nil {
+		panic(err)
+	}
+	defer ratelimit.Lim.Close()
 	// URLDeleter
 	deleteuserurl.URLDel = deleteuserurl.NewURLDeleter()
+	// запускаем gRPC сервер рядом с http
+	lis, err := net.Listen("tcp", config.Options.GRPCHost)
+	if err != nil {
+		panic(err)
+	}
+	grpcServer := grpcserver.NewServer(log)
+	defer grpcServer.GracefulStop()
+	go func() {
+		err := grpcServer.Serve(lis)
+		if err != nil {
+			log.Error("grpc server stopped", zap.Error(err))
+		}
+	}()
 	// запускаем сервер
-	router := router.MainRouter()
+	router := router.MainRouter(log, accessLog)
 	if router == nil {
 		panic(errors.New("failed to create main router"))
 	}
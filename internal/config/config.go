@@ -5,20 +5,111 @@ package config
 import (
 	flag "github.com/spf13/pflag"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Options Опции для запуска сервера
 var Options struct {
 	// Адрес сервера
 	Host string
+	// Адрес gRPC сервера
+	GRPCHost string
 	// Адрес хоста при формировании короткой ссылки
 	ShortURLHost string
 	// Путь к файловому хранилищу
 	FileStoragePath string
+	// Путь к файловому хранилищу пользователей
+	UsersFileStoragePath string
 	// Строка подключения к базе данных
 	DatabaseDSN string
 	// Секретный ключ для формирования UserID
 	PassphraseKey string
+	// Время жизни токена авторизации
+	TokenTTL time.Duration
+	// За сколько до истечения токен перевыпускается. 0 - не перевыпускать
+	TokenRefreshBefore time.Duration
+	// Путь к файлу с набором ключей подписи токенов
+	KeyringFile string
+	// Атрибут HttpOnly куки авторизации
+	CookieHTTPOnly bool
+	// Атрибут Secure куки авторизации
+	CookieSecure bool
+	// Атрибут SameSite куки авторизации: lax, strict, none
+	CookieSameSite string
+	// Атрибут Domain куки авторизации
+	CookieDomain string
+	// Экспортер трассировок: none, stdout, file, otlp
+	TraceExporter string
+	// Путь к файлу для экспортера трассировок file
+	TraceFile string
+	// Адрес OTLP коллектора (host:port)
+	TraceOTLPEndpoint string
+	// Уровень логирования: debug, info, warn, error
+	LogLevel string
+	// Формат лога: json или console
+	LogEncoding string
+	// Включение сэмплирования однотипных записей лога
+	LogSampling bool
+	// Куда писать лог: stdout, stderr или пути к файлам
+	LogOutputs []string
+	// Куда писать лог запросов. Если пусто - в основной лог
+	AccessLogOutputs []string
+	// Размер файла лога в мегабайтах, после которого он ротируется. 0 - без ограничения
+	LogMaxSize int
+	// Интервал ротации файла лога. 0 - без ротации по времени
+	LogRotateInterval time.Duration
+	// Количество хранимых старых файлов лога. 0 - хранить все
+	LogMaxBackups int
+	// Ограничения частоты запросов по группам маршрутов: group=rate:burst
+	RateLimits []string
+	// Хранить состояние ограничителя в Postgres, общее для всех экземпляров
+	RateLimitShared bool
+	// Квота активных ссылок пользователя по умолчанию. 0 - без ограничения
+	UserQuota int
+	// Индивидуальные квоты: userID=N
+	UserQuotaOverrides []string
+	// Разрешенные схемы сокращаемых ссылок
+	URLSchemes []string
+	// Сортировать параметры запроса при нормализации ссылки
+	URLSortQuery bool
+	// Файл разрешенных доменов. Если задан, разрешены только они и их поддомены
+	PolicyAllowFile string
+	// Файл запрещенных доменов
+	PolicyDenyFile string
+	// Файл запрещающих регулярных выражений по полной ссылке
+	PolicyRegexFile string
+	// Запрещенные подсети адресов назначения
+	PolicyDenyCIDRs []string
+	// Разрешать имя хоста в IP для проверки подсетей
+	PolicyResolve bool
+	// Интервал проверки изменения файлов политики
+	PolicyReloadInterval time.Duration
+	// Допустимая длина цепочки коротких ссылок на собственный домен. 0 - такие ссылки запрещены
+	RedirectMaxDepth int
+	// Код перенаправления по умолчанию
+	RedirectCode int
+	// Значение Cache-Control при перенаправлении по умолчанию
+	RedirectCachePolicy string
+	// Время закрепления варианта A/B теста за посетителем
+	VariantCookieTTL time.Duration
+	// Файл базы GeoIP в формате MaxMind (.mmdb)
+	GeoIPFile string
+	// Подсети доверенных прокси, от которых принимается X-Forwarded-For
+	TrustedProxies []string
+	// Подсеть, из которой доступна статистика сервиса по gRPC. Пусто - статистика недоступна
+	TrustedSubnet string
+	// Время действия доступа к ссылке после ввода пароля
+	LinkPasswordTTL time.Duration
+	// Шаблон HTML страницы ссылки, которая еще не активирована
+	ComingSoonFile string
+	// Запасной адрес для ссылок с закончившимся окном активности без собственного запасного адреса
+	FallbackURL string
+	// Срок действия подписи ссылки по умолчанию
+	SignedURLTTL time.Duration
+	// Наибольший срок действия подписи ссылки
+	SignedURLMaxTTL time.Duration
 }
 
 // ParseEnvFlags Обработка окружения и флагов для формирования конфигурации
@@ -28,6 +119,22 @@ func ParseEnvFlags() {
 	if !ok {
 		flag.StringVarP(&Options.PassphraseKey, "k", "k", "", "Пароль для ключа")
 	}
+	Options.KeyringFile, ok = os.LookupEnv("KEYRING_FILE")
+	if !ok {
+		flag.StringVar(&Options.KeyringFile, "keyring-file", "", "Путь к файлу с ключами подписи токенов")
+	}
+	lookupEnvDuration(&Options.TokenTTL, "TOKEN_TTL", "token-ttl", 24*time.Hour, "Время жизни токена авторизации")
+	lookupEnvDuration(&Options.TokenRefreshBefore, "TOKEN_REFRESH_BEFORE", "token-refresh-before", 6*time.Hour, "За сколько до истечения перевыпускать токен")
+	lookupEnvBool(&Options.CookieHTTPOnly, "COOKIE_HTTP_ONLY", "cookie-http-only", true, "Атрибут HttpOnly куки авторизации")
+	lookupEnvBool(&Options.CookieSecure, "COOKIE_SECURE", "cookie-secure", false, "Атрибут Secure куки авторизации")
+	Options.CookieSameSite, ok = os.LookupEnv("COOKIE_SAME_SITE")
+	if !ok {
+		flag.StringVar(&Options.CookieSameSite, "cookie-same-site", "lax", "Атрибут SameSite куки авторизации: lax, strict, none")
+	}
+	Options.CookieDomain, ok = os.LookupEnv("COOKIE_DOMAIN")
+	if !ok {
+		flag.StringVar(&Options.CookieDomain, "cookie-domain", "", "Атрибут Domain куки авторизации")
+	}
 	Options.DatabaseDSN, ok = os.LookupEnv("DATABASE_DSN")
 	if !ok {
 		flag.StringVarP(&Options.DatabaseDSN, "d", "d", "", "Строка подключения к БД")
@@ -36,6 +143,91 @@ func ParseEnvFlags() {
 	if !ok {
 		flag.StringVarP(&Options.FileStoragePath, "f", "f", "/tmp/short-url-db.json", "Путь к файлу для сохраненных ссылок")
 	}
+	Options.UsersFileStoragePath, ok = os.LookupEnv("USERS_FILE_STORAGE_PATH")
+	if !ok {
+		flag.StringVar(&Options.UsersFileStoragePath, "users-file", "/tmp/short-url-users.json", "Путь к файлу для зарегистрированных пользователей")
+	}
+	Options.GRPCHost, ok = os.LookupEnv("GRPC_ADDRESS")
+	if !ok {
+		flag.StringVarP(&Options.GRPCHost, "g", "g", ":3200", "Адрес gRPC-сервера")
+	}
+	Options.TraceExporter, ok = os.LookupEnv("TRACE_EXPORTER")
+	if !ok {
+		flag.StringVar(&Options.TraceExporter, "trace-exporter", "none", "Экспортер трассировок: none, stdout, file, otlp")
+	}
+	Options.TraceFile, ok = os.LookupEnv("TRACE_FILE")
+	if !ok {
+		flag.StringVar(&Options.TraceFile, "trace-file", "/tmp/shortener-traces.json", "Путь к файлу трассировок")
+	}
+	Options.TraceOTLPEndpoint, ok = os.LookupEnv("TRACE_OTLP_ENDPOINT")
+	if !ok {
+		flag.StringVar(&Options.TraceOTLPEndpoint, "trace-otlp-endpoint", "localhost:4318", "Адрес OTLP коллектора")
+	}
+	Options.LogLevel, ok = os.LookupEnv("LOG_LEVEL")
+	if !ok {
+		flag.StringVar(&Options.LogLevel, "log-level", "info", "Уровень логирования")
+	}
+	Options.LogEncoding, ok = os.LookupEnv("LOG_ENCODING")
+	if !ok {
+		flag.StringVar(&Options.LogEncoding, "log-encoding", "console", "Формат лога: json, console")
+	}
+	lookupEnvBool(&Options.LogSampling, "LOG_SAMPLING", "log-sampling", false, "Сэмплирование однотипных записей лога")
+	lookupEnvSlice(&Options.LogOutputs, "LOG_OUTPUTS", "log-outputs", []string{"stderr"}, "Куда писать лог: stdout, stderr, путь к файлу")
+	lookupEnvSlice(&Options.AccessLogOutputs, "ACCESS_LOG_OUTPUTS", "access-log-outputs", nil, "Куда писать лог запросов")
+	lookupEnvInt(&Options.LogMaxSize, "LOG_MAX_SIZE", "log-max-size", 100, "Размер файла лога для ротации, МБ")
+	lookupEnvDuration(&Options.LogRotateInterval, "LOG_ROTATE_INTERVAL", "log-rotate-interval", 24*time.Hour, "Интервал ротации файла лога")
+	lookupEnvInt(&Options.LogMaxBackups, "LOG_MAX_BACKUPS", "log-max-backups", 7, "Количество хранимых старых файлов лога")
+	lookupEnvSlice(&Options.RateLimits, "RATE_LIMITS", "rate-limits", nil,
+		"Ограничения частоты запросов по группам: group=rate:burst, например redirect=50:100,batch=1:5. По умолчанию без ограничений")
+	lookupEnvBool(&Options.RateLimitShared, "RATE_LIMIT_SHARED", "rate-limit-shared", false, "Общий для экземпляров ограничитель в Postgres")
+	lookupEnvInt(&Options.UserQuota, "USER_QUOTA", "user-quota", 0, "Квота активных ссылок пользователя, 0 - без ограничения")
+	lookupEnvSlice(&Options.UserQuotaOverrides, "USER_QUOTA_OVERRIDES", "user-quota-overrides", nil, "Индивидуальные квоты: userID=N")
+	lookupEnvSlice(&Options.URLSchemes, "URL_SCHEMES", "url-schemes", []string{"http", "https"}, "Разрешенные схемы сокращаемых ссылок")
+	lookupEnvBool(&Options.URLSortQuery, "URL_SORT_QUERY", "url-sort-query", false, "Сортировать параметры запроса при нормализации ссылки")
+	Options.PolicyAllowFile, ok = os.LookupEnv("POLICY_ALLOW_FILE")
+	if !ok {
+		flag.StringVar(&Options.PolicyAllowFile, "policy-allow-file", "", "Файл разрешенных доменов")
+	}
+	Options.PolicyDenyFile, ok = os.LookupEnv("POLICY_DENY_FILE")
+	if !ok {
+		flag.StringVar(&Options.PolicyDenyFile, "policy-deny-file", "", "Файл запрещенных доменов")
+	}
+	Options.PolicyRegexFile, ok = os.LookupEnv("POLICY_REGEX_FILE")
+	if !ok {
+		flag.StringVar(&Options.PolicyRegexFile, "policy-regex-file", "", "Файл запрещающих регулярных выражений")
+	}
+	lookupEnvSlice(&Options.PolicyDenyCIDRs, "POLICY_DENY_CIDRS", "policy-deny-cidrs",
+		[]string{"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "0.0.0.0/8", "::1/128", "fc00::/7", "fe80::/10"},
+		"Запрещенные подсети адресов назначения")
+	lookupEnvBool(&Options.PolicyResolve, "POLICY_RESOLVE", "policy-resolve", false, "Разрешать имя хоста в IP для проверки подсетей")
+	lookupEnvDuration(&Options.PolicyReloadInterval, "POLICY_RELOAD_INTERVAL", "policy-reload-interval", time.Minute, "Интервал проверки изменения файлов политики, 0 - не проверять")
+	lookupEnvInt(&Options.RedirectMaxDepth, "REDIRECT_MAX_DEPTH", "redirect-max-depth", 2, "Допустимая длина цепочки коротких ссылок на собственный домен, 0 - запрещены")
+	lookupEnvInt(&Options.RedirectCode, "REDIRECT_CODE", "redirect-code", 307, "Код перенаправления по умолчанию: 301, 302, 307, 308")
+	lookupEnvDuration(&Options.LinkPasswordTTL, "LINK_PASSWORD_TTL", "link-password-ttl", 15*time.Minute, "Время действия доступа к ссылке после ввода пароля")
+	lookupEnvDuration(&Options.SignedURLTTL, "SIGNED_URL_TTL", "signed-url-ttl", 24*time.Hour, "Срок действия подписи ссылки по умолчанию")
+	lookupEnvDuration(&Options.SignedURLMaxTTL, "SIGNED_URL_MAX_TTL", "signed-url-max-ttl", 30*24*time.Hour, "Наибольший срок действия подписи ссылки")
+	lookupEnvDuration(&Options.VariantCookieTTL, "VARIANT_COOKIE_TTL", "variant-cookie-ttl", 30*24*time.Hour, "Время закрепления варианта A/B теста за посетителем")
+	Options.RedirectCachePolicy, ok = os.LookupEnv("REDIRECT_CACHE_POLICY")
+	if !ok {
+		flag.StringVar(&Options.RedirectCachePolicy, "redirect-cache-policy", "", "Значение Cache-Control при перенаправлении по умолчанию")
+	}
+	Options.GeoIPFile, ok = os.LookupEnv("GEOIP_FILE")
+	if !ok {
+		flag.StringVar(&Options.GeoIPFile, "geoip-file", "", "Файл базы GeoIP в формате MaxMind (.mmdb)")
+	}
+	Options.ComingSoonFile, ok = os.LookupEnv("COMING_SOON_FILE")
+	if !ok {
+		flag.StringVar(&Options.ComingSoonFile, "coming-soon-file", "", "Шаблон HTML страницы еще не активированной ссылки")
+	}
+	Options.FallbackURL, ok = os.LookupEnv("FALLBACK_URL")
+	if !ok {
+		flag.StringVar(&Options.FallbackURL, "fallback-url", "", "Запасной адрес для ссылок с закончившимся окном активности")
+	}
+	lookupEnvSlice(&Options.TrustedProxies, "TRUSTED_PROXIES", "trusted-proxies", nil, "Подсети доверенных прокси, от которых принимается X-Forwarded-For")
+	Options.TrustedSubnet, ok = os.LookupEnv("TRUSTED_SUBNET")
+	if !ok {
+		flag.StringVar(&Options.TrustedSubnet, "trusted-subnet", "", "Подсеть, из которой доступна статистика сервиса")
+	}
 	// ищем переменную SERVER_ADDRESS
 	Options.Host, ok = os.LookupEnv(`SERVER_ADDRESS`)
 	if !ok {
@@ -54,3 +246,53 @@ func ParseEnvFlags() {
 		flag.Parse()
 	}
 }
+
+// lookupEnvBool Чтение логического параметра из окружения или флага
+func lookupEnvBool(p *bool, env, name string, value bool, usage string) {
+	if v, ok := os.LookupEnv(env); ok {
+		b, err := strconv.ParseBool(v)
+		if err == nil {
+			*p = b
+			return
+		}
+	}
+	flag.BoolVar(p, name, value, usage)
+}
+
+// lookupEnvInt Чтение целочисленного параметра из окружения или флага
+func lookupEnvInt(p *int, env, name string, value int, usage string) {
+	if v, ok := os.LookupEnv(env); ok {
+		i, err := strconv.Atoi(v)
+		if err == nil {
+			*p = i
+			return
+		}
+	}
+	flag.IntVar(p, name, value, usage)
+}
+
+// lookupEnvDuration Чтение интервала из окружения или флага
+func lookupEnvDuration(p *time.Duration, env, name string, value time.Duration, usage string) {
+	if v, ok := os.LookupEnv(env); ok {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			*p = d
+			return
+		}
+	}
+	flag.DurationVar(p, name, value, usage)
+}
+
+// lookupEnvSlice Чтение списка значений через запятую из окружения или флага
+func lookupEnvSlice(p *[]string, env, name string, value []string, usage string) {
+	if v, ok := os.LookupEnv(env); ok {
+		*p = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+		return
+	}
+	flag.StringSliceVar(p, name, value, usage)
+}
@@ -3,8 +3,12 @@
 package deleteuserurl
 
 import (
-	"github.com/gerasimovpavel/shortener.git/internal/middleware"
+	"context"
+	"github.com/gerasimovpavel/shortener.git/internal/metrics"
 	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/internal/tracing"
+	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"go.uber.org/zap"
 	"sync"
 )
 
@@ -45,13 +49,19 @@ func (ud *URLDeleter) generator(urls *[]string) chan []string {
 	return ch
 }
 
-// AddURL Добавление короткой ссылки на удаление
-func (ud *URLDeleter) AddURL(urls *[]string) {
+// AddURL Добавление коротких ссылок пользователя userID на удаление.
+// Удаление выполняется асинхронно, поэтому отмена ctx на него не влияет,
+// но значения контекста (трассировка) сохраняются. Хранилище фиксируется в момент вызова
+func (ud *URLDeleter) AddURL(ctx context.Context, userID string, urls *[]string) {
+	ctx = context.WithoutCancel(ctx)
+	stor := storage.Stor
+	metrics.DeleteQueueDepth.Inc()
 	g := ud.generator(urls)
 	out := ud.merge(g)
 	go func() {
 		for s := range out {
-			ud.deleteURL(s)
+			ud.deleteURL(ctx, stor, userID, s)
+			metrics.DeleteQueueDepth.Dec()
 		}
 	}()
 }
@@ -75,16 +85,26 @@ func (ud *URLDeleter) merge(in ...<-chan []string) <-chan []string {
 	return out
 }
 
-func (ud *URLDeleter) deleteURL(list []string) {
+func (ud *URLDeleter) deleteURL(ctx context.Context, stor storage.Storage, userID string, list []string) {
+	ctx, span := tracing.Tracer().Start(ctx, "deleteuserurl.deleteURL")
+	defer span.End()
+
 	urls := []*storage.URLData{}
 	for _, url := range list {
 		data := storage.URLData{}
 
-		data.UserID = middleware.UserID
+		data.UserID = userID
 		data.ShortURL = url
 		urls = append(urls, &data)
 	}
 
-	storage.Stor.DeleteUserURL(urls)
-
+	err := stor.DeleteUserURL(ctx, urls)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to delete user urls",
+			zap.Int("count", len(urls)),
+			zap.Error(err),
+		)
+		return
+	}
+	logger.FromContext(ctx).Debug("user urls deleted", zap.Int("count", len(urls)))
 }
@@ -1,6 +1,7 @@
 package deleteuserurl
 
 import (
+	"context"
 	"fmt"
 	"github.com/brianvoe/gofakeit"
 	"github.com/gerasimovpavel/shortener.git/internal/storage"
@@ -31,12 +32,12 @@ func Test_DeleteUserURL(t *testing.T) {
 		urls = append(urls, &storage.URLData{CorrID: gofakeit.UUID(), OriginalURL: gofakeit.URL(), UserID: userID})
 	}
 
-	err = storage.Stor.PostBatch(urls)
+	err = storage.Stor.PostBatch(context.Background(), urls)
 	if err != nil {
 		panic(fmt.Errorf("failed to post to storage: %w", err))
 	}
 
-	urls, err = storage.Stor.GetUserURL(userID)
+	urls, err = storage.Stor.GetUserURL(context.Background(), userID)
 	if err != nil {
 		panic(fmt.Errorf("failed to get from storage: %w", err))
 	}
@@ -44,5 +45,5 @@ func Test_DeleteUserURL(t *testing.T) {
 	for _, url := range urls {
 		list = append(list, url.ShortURL)
 	}
-	URLDel.AddURL(&list)
+	URLDel.AddURL(context.Background(), userID, &list)
 }
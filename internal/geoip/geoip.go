@@ -0,0 +1,79 @@
+// Package geoip реализует определение страны клиента по локальной базе GeoIP в формате MaxMind
+package geoip
+
+import (
+	"github.com/oschwald/maxminddb-golang"
+	"net"
+)
+
+// EU Обозначение стран Европейского союза в правилах ссылок
+const EU = "EU"
+
+// Country Страна клиента
+type Country struct {
+	// Код страны ISO 3166-1 alpha-2
+	ISOCode string
+	// Страна входит в Европейский союз
+	EU bool
+}
+
+// record Запись базы GeoIP, из которой читается только страна
+type record struct {
+	Country struct {
+		ISOCode           string `maxminddb:"iso_code"`
+		IsInEuropeanUnion bool   `maxminddb:"is_in_european_union"`
+	} `maxminddb:"country"`
+}
+
+// Reader База GeoIP
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+// DB Открытая база GeoIP. nil - страна клиента не определяется
+var DB *Reader
+
+// Open Открытие базы GeoIP из файла .mmdb
+func Open(filename string) (*Reader, error) {
+	db, err := maxminddb.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// Country Страна, к которой относится адрес ip. Адрес, которого нет в базе, дает пустую страну
+func (r *Reader) Country(ip net.IP) (Country, error) {
+	var rec record
+	if err := r.db.Lookup(ip, &rec); err != nil {
+		return Country{}, err
+	}
+	return Country{ISOCode: rec.Country.ISOCode, EU: rec.Country.IsInEuropeanUnion}, nil
+}
+
+// Close Закрытие базы
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
+
+// Lookup Страна клиента с адресом ip по базе DB.
+// Без базы, для неверного или отсутствующего в базе адреса страна пустая
+func Lookup(ip string) Country {
+	addr := net.ParseIP(ip)
+	if DB == nil || addr == nil {
+		return Country{}
+	}
+	country, err := DB.Country(addr)
+	if err != nil {
+		return Country{}
+	}
+	return country
+}
+
+// Match Совпадает ли страна с кодом из правила: код страны или EU для стран Европейского союза
+func (c Country) Match(code string) bool {
+	if code == EU {
+		return c.EU
+	}
+	return c.ISOCode != "" && c.ISOCode == code
+}
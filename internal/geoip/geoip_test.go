@@ -0,0 +1,60 @@
+package geoip
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// testDB Тестовая база, создается testdata/gen.go
+const testDB = "testdata/country.mmdb"
+
+func Test_Lookup(t *testing.T) {
+	db, err := Open(testDB)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	if err = db.db.Verify(); err != nil {
+		panic(err)
+	}
+	DB = db
+	defer func() { DB = nil }()
+
+	tests := []struct {
+		name string
+		ip   string
+		want Country
+	}{
+		{"eu country", "2.125.160.216", Country{ISOCode: "DE", EU: true}},
+		{"other eu country", "89.160.20.112", Country{ISOCode: "SE", EU: true}},
+		{"non eu country", "81.2.69.142", Country{ISOCode: "GB"}},
+		{"other country", "216.160.83.56", Country{ISOCode: "US"}},
+		{"not in database", "8.8.8.8", Country{}},
+		{"ipv6 in ipv4 database", "2001:db8::1", Country{}},
+		{"bad address", "unknown", Country{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Lookup(tt.ip); !assert.Equal(t, tt.want, got) {
+				panic(fmt.Errorf("country expect %v actual %v", tt.want, got))
+			}
+		})
+	}
+}
+
+func Test_LookupWithoutDB(t *testing.T) {
+	assert.Equal(t, Country{}, Lookup("2.125.160.216"))
+}
+
+func Test_Match(t *testing.T) {
+	de := Country{ISOCode: "DE", EU: true}
+	gb := Country{ISOCode: "GB"}
+	assert.True(t, de.Match("DE"))
+	assert.True(t, de.Match(EU))
+	assert.False(t, gb.Match(EU))
+	assert.False(t, gb.Match("DE"))
+	assert.False(t, Country{}.Match(""))
+	_, err := Open("testdata/missing.mmdb")
+	assert.Error(t, err)
+}
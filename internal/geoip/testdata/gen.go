@@ -0,0 +1,158 @@
+//go:build ignore
+
+// Генератор тестовой базы GeoIP country.mmdb: IPv4, размер записи 24 бита.
+// Запуск: go run gen.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"time"
+)
+
+// countries Подсети тестовой базы
+var countries = []struct {
+	cidr string
+	iso  string
+	eu   bool
+}{
+	{"2.125.160.0/24", "DE", true},
+	{"81.2.69.0/24", "GB", false},
+	{"89.160.20.0/24", "SE", true},
+	{"216.160.83.0/24", "US", false},
+}
+
+// empty Запись дерева без данных
+const empty = -1
+
+func main() {
+	data := &bytes.Buffer{}
+	// узлы дерева поиска, отрицательные записи меньше empty - смещение данных -(offset+2)
+	nodes := [][2]int{{empty, empty}}
+	for _, c := range countries {
+		_, n, err := net.ParseCIDR(c.cidr)
+		if err != nil {
+			panic(err)
+		}
+		offset := data.Len()
+		country := []any{"iso_code", c.iso}
+		if c.eu {
+			country = append(country, "is_in_european_union", true)
+		}
+		encode(data, []any{"country", country})
+
+		ones, _ := n.Mask.Size()
+		ip := n.IP.To4()
+		cur := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-i%8)) & 1
+			if i == ones-1 {
+				nodes[cur][bit] = -(offset + 2)
+				break
+			}
+			if nodes[cur][bit] == empty {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[cur][bit] = len(nodes) - 1
+			}
+			cur = nodes[cur][bit]
+		}
+	}
+
+	out := &bytes.Buffer{}
+	record := func(v int) int {
+		switch {
+		case v == empty:
+			return len(nodes)
+		case v < empty:
+			return len(nodes) + 16 + (-v - 2)
+		}
+		return v
+	}
+	for _, n := range nodes {
+		for _, v := range n {
+			v = record(v)
+			out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encode(out, []any{
+		"binary_format_major_version", uint16(2),
+		"binary_format_minor_version", uint16(0),
+		"build_epoch", uint64(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix()),
+		"database_type", "Shortener-Test-Country",
+		"description", []any{"en", "Shortener test country database"},
+		"ip_version", uint16(4),
+		"languages", []string{"en"},
+		"node_count", uint32(len(nodes)),
+		"record_size", uint16(24),
+	})
+	if err := os.WriteFile("country.mmdb", out.Bytes(), 0644); err != nil {
+		panic(err)
+	}
+}
+
+// encode Запись значения в формате данных MaxMind DB. []any - словарь из пар ключ, значение
+func encode(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		control(buf, 2, len(v))
+		buf.WriteString(v)
+	case []any:
+		control(buf, 7, len(v)/2)
+		for _, item := range v {
+			encode(buf, item)
+		}
+	case []string:
+		control(buf, 11, len(v))
+		for _, item := range v {
+			encode(buf, item)
+		}
+	case bool:
+		n := 0
+		if v {
+			n = 1
+		}
+		control(buf, 14, n)
+	case uint16:
+		unsigned(buf, 5, uint64(v))
+	case uint32:
+		unsigned(buf, 6, uint64(v))
+	case uint64:
+		unsigned(buf, 9, v)
+	default:
+		panic("неподдерживаемый тип")
+	}
+}
+
+// unsigned Запись беззнакового целого минимальным числом байт
+func unsigned(buf *bytes.Buffer, typ int, v uint64) {
+	b := binary.BigEndian.AppendUint64(nil, v)
+	b = bytes.TrimLeft(b, "\x00")
+	control(buf, typ, len(b))
+	buf.Write(b)
+}
+
+// control Управляющий байт: тип и размер. Расширенный тип пишется отдельным байтом,
+// размер от 29 до 284 - байтом после типа
+func control(buf *bytes.Buffer, typ, size int) {
+	if size > 284 {
+		panic("размер больше 284 не поддерживается")
+	}
+	head := size
+	if size >= 29 {
+		head = 29
+	}
+	if typ <= 7 {
+		buf.WriteByte(byte(typ<<5 | head))
+	} else {
+		buf.WriteByte(byte(head))
+		buf.WriteByte(byte(typ - 7))
+	}
+	if size >= 29 {
+		buf.WriteByte(byte(size - 29))
+	}
+}
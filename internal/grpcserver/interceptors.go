@@ -0,0 +1,165 @@
+// Package grpcserver реализует перехватчики gRPC запросов для логирования и авторизации
+package grpcserver
+
+import (
+	"context"
+	"github.com/gerasimovpavel/shortener.git/internal/middleware"
+	pb "github.com/gerasimovpavel/shortener.git/internal/proto"
+	"github.com/gerasimovpavel/shortener.git/internal/users"
+	"github.com/gerasimovpavel/shortener.git/pkg/cookies"
+	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
+	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net"
+	"time"
+)
+
+// AuthMetadataKey Ключ метаданных с токеном пользователя
+const AuthMetadataKey = "authorization"
+
+// RequestIDMetadataKey Ключ метаданных с идентификатором запроса
+const RequestIDMetadataKey = "x-request-id"
+
+type userIDKey struct{}
+
+// authenticatedKey Ключ контекста для признака токена зарегистрированного пользователя
+type authenticatedKey struct{}
+
+// publicMethods Методы, не требующие идентификации пользователя
+var publicMethods = map[string]bool{
+	pb.Shortener_Expand_FullMethodName: true,
+	pb.Shortener_Ping_FullMethodName:   true,
+}
+
+// strictMethods Методы, требующие уже выданного токена (аналог middleware.AuthHeader)
+var strictMethods = map[string]bool{
+	pb.Shortener_ListUserURLs_FullMethodName: true,
+}
+
+// trustedMethods Служебные методы, доступные только из доверенной подсети.
+// Токен для них не подходит: анонимный токен выдается любому клиенту
+var trustedMethods = map[string]bool{
+	pb.Shortener_Stats_FullMethodName: true,
+}
+
+// TrustedSubnet Подсеть, из которой доступны служебные методы. nil - методы недоступны
+var TrustedSubnet *net.IPNet
+
+// UserIDFromContext ID пользователя из контекста gRPC запроса
+func UserIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(userIDKey{}).(string)
+	return id
+}
+
+// authenticated Запрос авторизован токеном зарегистрированного пользователя (аналог middleware.Authenticated)
+func authenticated(ctx context.Context) bool {
+	ok, _ := ctx.Value(authenticatedKey{}).(bool)
+	return ok
+}
+
+// LoggingInterceptor Запись gRPC запросов в лог с идентификатором запроса
+func LoggingInterceptor(l *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		var id string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(RequestIDMetadataKey); len(v) > 0 {
+				id = v[0]
+			}
+		}
+		if !middleware.ValidRequestID(id) {
+			id = middleware.NewRequestID()
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, id))
+		ctx = middleware.WithRequestID(ctx, id)
+		ctx = logger.WithContext(ctx, l.With(zap.String("request_id", id)))
+
+		resp, err := handler(ctx, req)
+
+		l.Info("grpc request",
+			zap.String("request_id", id),
+			zap.String("method", info.FullMethod),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("code", status.Code(err).String()),
+		)
+		return resp, err
+	}
+}
+
+// AuthInterceptor Идентификация пользователя по метаданным authorization.
+// Если токена нет, выдается новый и возвращается в заголовке ответа
+func AuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	if trustedMethods[info.FullMethod] {
+		if !trustedPeer(ctx) {
+			return nil, status.Error(codes.PermissionDenied, "метод доступен только из доверенной подсети")
+		}
+		return handler(ctx, req)
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(AuthMetadataKey); len(v) > 0 {
+			token = v[0]
+		}
+	}
+
+	if token == "" {
+		if strictMethods[info.FullMethod] {
+			return nil, status.Error(codes.Unauthenticated, "токен не передан")
+		}
+		cookie, err := cookies.NewCookie(nil)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		token = cookie.Value
+		err = grpc.SetHeader(ctx, metadata.Pairs(AuthMetadataKey, token))
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	claims, err := crypt.ParseToken(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if claims.ID != "" {
+		revoked, err := users.Stor.IsTokenRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if revoked {
+			return nil, status.Error(codes.Unauthenticated, middleware.ErrTokenRevoked.Error())
+		}
+	}
+	// токен подписан выведенным из оборота ключом или скоро истекает - перевыпускаем
+	if claims.NeedsRefresh() {
+		token, _, err = crypt.Reissue(claims)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		err = grpc.SetHeader(ctx, metadata.Pairs(AuthMetadataKey, token))
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	ctx = context.WithValue(ctx, userIDKey{}, claims.UserID)
+	if claims.Registered {
+		ctx = context.WithValue(ctx, authenticatedKey{}, true)
+	}
+	return handler(ctx, req)
+}
+
+// trustedPeer Входит ли адрес клиента в доверенную подсеть
+func trustedPeer(ctx context.Context) bool {
+	ip := net.ParseIP(peerIP(ctx))
+	return ip != nil && TrustedSubnet != nil && TrustedSubnet.Contains(ip)
+}
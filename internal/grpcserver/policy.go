@@ -0,0 +1,46 @@
+// Package grpcserver реализует проверку политики адресов назначения
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"github.com/gerasimovpavel/shortener.git/internal/policy"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkPolicy Проверка адреса назначения и цепочки коротких ссылок перед сохранением.
+// Нарушение возвращается как PermissionDenied с причиной в ErrorInfo
+func checkPolicy(ctx context.Context, originalURL, corrID string) error {
+	err := policy.Current().Check(ctx, originalURL)
+	if err == nil {
+		err = policy.CheckChain(ctx, storage.Stor, "", originalURL)
+	}
+	if err == nil {
+		return nil
+	}
+	var violation *policy.Violation
+	if !errors.As(err, &violation) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return policyError(violation, corrID)
+}
+
+// policyError Ошибка gRPC с причиной нарушения политики
+func policyError(v *policy.Violation, corrID string) error {
+	st := status.New(codes.PermissionDenied, v.Error())
+	info := &errdetails.ErrorInfo{
+		Reason:   v.Reason,
+		Domain:   "shortener",
+		Metadata: map[string]string{"rule": v.Rule},
+	}
+	if corrID != "" {
+		info.Metadata["correlation_id"] = corrID
+	}
+	if withDetails, err := st.WithDetails(info); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
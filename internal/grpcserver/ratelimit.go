@@ -0,0 +1,78 @@
+// Package grpcserver реализует ограничение частоты gRPC запросов
+package grpcserver
+
+import (
+	"context"
+	"github.com/gerasimovpavel/shortener.git/internal/metrics"
+	pb "github.com/gerasimovpavel/shortener.git/internal/proto"
+	"github.com/gerasimovpavel/shortener.git/internal/ratelimit"
+	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"math"
+	"net"
+	"time"
+)
+
+// methodGroups Группы ограничений методов, общие с маршрутами HTTP
+var methodGroups = map[string]string{
+	pb.Shortener_Expand_FullMethodName:         ratelimit.GroupRedirect,
+	pb.Shortener_Shorten_FullMethodName:        ratelimit.GroupShorten,
+	pb.Shortener_ShortenBatch_FullMethodName:   ratelimit.GroupBatch,
+	pb.Shortener_ListUserURLs_FullMethodName:   ratelimit.GroupUser,
+	pb.Shortener_DeleteUserURLs_FullMethodName: ratelimit.GroupUser,
+}
+
+// RateLimitInterceptor Ограничение частоты запросов по группам ratelimit, как middleware.RateLimit.
+// Корзина выбирается по ID зарегистрированного пользователя, иначе по IP клиента.
+// Ставится после AuthInterceptor. Превышение - ResourceExhausted с RetryInfo
+func RateLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	group, ok := methodGroups[info.FullMethod]
+	limit := ratelimit.Limits[group]
+	if !ok || ratelimit.Lim == nil || !limit.Enabled() {
+		return handler(ctx, req)
+	}
+
+	key := "ip:" + peerIP(ctx)
+	if id := UserIDFromContext(ctx); id != "" && authenticated(ctx) {
+		key = "user:" + id
+	}
+	allowed, retry, err := ratelimit.Lim.Allow(ctx, group+":"+key, limit)
+	if err != nil {
+		logger.FromContext(ctx).Error("rate limiter failed", zap.String("group", group), zap.Error(err))
+		return handler(ctx, req)
+	}
+	if !allowed {
+		metrics.RateLimited.WithLabelValues(group).Inc()
+		return nil, rateLimitError(retry)
+	}
+	return handler(ctx, req)
+}
+
+// rateLimitError Ошибка gRPC с временем до следующей попытки в RetryInfo
+func rateLimitError(retry time.Duration) error {
+	st := status.New(codes.ResourceExhausted, "слишком много запросов")
+	delay := time.Duration(math.Max(1, math.Ceil(retry.Seconds()))) * time.Second
+	if withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// peerIP IP клиента gRPC запроса
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,212 @@
+// Package grpcserver реализует gRPC API сервиса сокращения ссылок
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/deleteuserurl"
+	"github.com/gerasimovpavel/shortener.git/internal/policy"
+	pb "github.com/gerasimovpavel/shortener.git/internal/proto"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// Server Реализация gRPC сервиса Shortener
+type Server struct {
+	pb.UnimplementedShortenerServer
+}
+
+// NewServer Создание gRPC сервера с перехватчиками логирования, авторизации и ограничения частоты запросов
+func NewServer(log *zap.Logger) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			LoggingInterceptor(log),
+			AuthInterceptor,
+			RateLimitInterceptor,
+		),
+	)
+	pb.RegisterShortenerServer(s, &Server{})
+	return s
+}
+
+// shortURL Полный адрес короткой ссылки
+func shortURL(short string) string {
+	return fmt.Sprintf(`%s/%s`, config.Options.ShortURLHost, short)
+}
+
+// Shorten Сокращение одной ссылки
+func (s *Server) Shorten(ctx context.Context, req *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	if req.GetUrl() == "" {
+		return nil, status.Error(codes.InvalidArgument, "URL не указан")
+	}
+	originalURL, err := urlnorm.Normalize(req.GetUrl())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err = checkPolicy(ctx, originalURL, ""); err != nil {
+		return nil, err
+	}
+	data := storage.URLData{
+		OriginalURL: originalURL,
+		UserID:      UserIDFromContext(ctx),
+	}
+	err = storage.Stor.Post(ctx, &data)
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil && !errors.Is(err, storage.ErrDataConflict) {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.ShortenResponse{
+		Result:   shortURL(data.ShortURL),
+		Conflict: errors.Is(err, storage.ErrDataConflict),
+	}, nil
+}
+
+// ShortenBatch Пакетное сокращение ссылок
+func (s *Server) ShortenBatch(ctx context.Context, req *pb.ShortenBatchRequest) (*pb.ShortenBatchResponse, error) {
+	userID := UserIDFromContext(ctx)
+	urls := make([]*storage.URLData, 0, len(req.GetUrls()))
+	for _, item := range req.GetUrls() {
+		if item.GetOriginalUrl() == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "URL не указан: %s", item.GetCorrelationId())
+		}
+		originalURL, err := urlnorm.Normalize(item.GetOriginalUrl())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s: %v", item.GetCorrelationId(), err)
+		}
+		if err = checkPolicy(ctx, originalURL, item.GetCorrelationId()); err != nil {
+			return nil, err
+		}
+		urls = append(urls, &storage.URLData{
+			CorrID:      item.GetCorrelationId(),
+			OriginalURL: originalURL,
+			UserID:      userID,
+		})
+	}
+	err := storage.Stor.PostBatch(ctx, urls)
+	if err != nil && !errors.Is(err, storage.ErrDataConflict) && !errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &pb.ShortenBatchResponse{Conflict: errors.Is(err, storage.ErrDataConflict)}
+	for _, data := range urls {
+		// ссылки сверх квоты в ответ не попадают
+		if data.Error != "" {
+			continue
+		}
+		resp.Urls = append(resp.Urls, &pb.BatchItem{
+			CorrelationId: data.CorrID,
+			ShortUrl:      shortURL(data.ShortURL),
+		})
+	}
+	if len(resp.Urls) == 0 && errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, status.Error(codes.ResourceExhausted, storage.ErrQuotaExceeded.Error())
+	}
+	return resp, nil
+}
+
+// Expand Получение оригинальной ссылки по короткой
+func (s *Server) Expand(ctx context.Context, req *pb.ExpandRequest) (*pb.ExpandResponse, error) {
+	if req.GetShortUrl() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Ссылка не указана")
+	}
+	data, err := storage.Stor.Get(ctx, req.GetShortUrl())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка чтения: %v", err)
+	}
+	if data.OriginalURL == "" {
+		return nil, status.Error(codes.NotFound, "url not found")
+	}
+	if data.DeletedFlag {
+		return nil, status.Error(codes.NotFound, "url has been deleted")
+	}
+	// вне окна активности раскрывается запасной адрес
+	if phase := data.Phase(time.Now()); phase != storage.PhaseActive {
+		fallback := data.Fallback(phase)
+		if fallback == "" {
+			return nil, status.Error(codes.FailedPrecondition, "ссылка вне окна активности")
+		}
+		return &pb.ExpandResponse{OriginalUrl: fallback}, nil
+	}
+	// адрес ссылки с паролем раскрывается только после ввода пароля при переходе
+	if data.PasswordHash != "" {
+		return nil, status.Error(codes.PermissionDenied, "ссылка защищена паролем")
+	}
+	// адрес ссылки с обязательной подписью раскрывается только при переходе по подписанной ссылке
+	if data.RequireSignature {
+		return nil, status.Error(codes.PermissionDenied, "ссылка требует подписи")
+	}
+	var violation *policy.Violation
+	if errors.As(policy.Current().CheckStored(ctx, data.OriginalURL), &violation) {
+		return nil, policyError(violation, "")
+	}
+	err = policy.CheckChain(ctx, storage.Stor, data.ShortURL, data.OriginalURL)
+	if errors.As(err, &violation) {
+		return nil, policyError(violation, "")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка чтения: %v", err)
+	}
+	// раскрытие адреса ссылки с ограничением расходует переход
+	if data.MaxClicks > 0 {
+		_, err = storage.Stor.ConsumeClick(ctx, data.ShortURL)
+		if errors.Is(err, storage.ErrClicksExhausted) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "ошибка записи: %v", err)
+		}
+	}
+	return &pb.ExpandResponse{OriginalUrl: data.OriginalURL}, nil
+}
+
+// ListUserURLs Ссылки пользователя
+func (s *Server) ListUserURLs(ctx context.Context, _ *pb.ListUserURLsRequest) (*pb.ListUserURLsResponse, error) {
+	urls, err := storage.Stor.GetUserURL(ctx, UserIDFromContext(ctx))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка чтения: %v", err)
+	}
+	resp := &pb.ListUserURLsResponse{}
+	for _, data := range urls {
+		resp.Urls = append(resp.Urls, &pb.UserURL{
+			ShortUrl:    shortURL(data.ShortURL),
+			OriginalUrl: data.OriginalURL,
+		})
+	}
+	return resp, nil
+}
+
+// DeleteUserURLs Асинхронное удаление ссылок пользователя
+func (s *Server) DeleteUserURLs(ctx context.Context, req *pb.DeleteUserURLsRequest) (*pb.DeleteUserURLsResponse, error) {
+	list := req.GetShortUrls()
+	if len(list) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "список ссылок пуст")
+	}
+	deleteuserurl.URLDel.AddURL(ctx, UserIDFromContext(ctx), &list)
+	return &pb.DeleteUserURLsResponse{}, nil
+}
+
+// Stats Статистика сервиса
+func (s *Server) Stats(ctx context.Context, _ *pb.StatsRequest) (*pb.StatsResponse, error) {
+	stats, err := storage.Stor.Stats(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка чтения: %v", err)
+	}
+	return &pb.StatsResponse{Urls: int64(stats.URLs), Users: int64(stats.Users)}, nil
+}
+
+// Ping Проверка доступности хранилища
+func (s *Server) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	err := storage.Stor.Ping(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &pb.PingResponse{}, nil
+}
@@ -0,0 +1,254 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"github.com/brianvoe/gofakeit"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/deleteuserurl"
+	pb "github.com/gerasimovpavel/shortener.git/internal/proto"
+	"github.com/gerasimovpavel/shortener.git/internal/ratelimit"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/internal/users"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestClient() (pb.ShortenerClient, func()) {
+	lis := bufconn.Listen(1024 * 1024)
+	s := NewServer(zap.NewNop())
+	go s.Serve(lis)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return pb.NewShortenerClient(conn), func() {
+		conn.Close()
+		s.Stop()
+	}
+}
+
+func Test_Server(t *testing.T) {
+	var err error
+	config.Options.ShortURLHost = "http://localhost:8080"
+	config.Options.PassphraseKey = "grpc test key"
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	users.Stor, err = users.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	deleteuserurl.URLDel = deleteuserurl.NewURLDeleter()
+
+	client, stop := newTestClient()
+	defer stop()
+	ctx := context.Background()
+
+	// без токена ссылки пользователя недоступны
+	_, err = client.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// при сокращении без токена выдается новый
+	var header metadata.MD
+	originalURL := gofakeit.URL()
+	resp, err := client.Shorten(ctx, &pb.ShortenRequest{Url: originalURL}, grpc.Header(&header))
+	if err != nil {
+		panic(fmt.Errorf("shorten: %w", err))
+	}
+	token := header.Get(AuthMetadataKey)
+	if !assert.Len(t, token, 1) {
+		panic("token not issued")
+	}
+	assert.NotEmpty(t, header.Get(RequestIDMetadataKey))
+	assert.False(t, resp.GetConflict())
+
+	authCtx := metadata.AppendToOutgoingContext(ctx, AuthMetadataKey, token[0])
+
+	resp2, err := client.Shorten(authCtx, &pb.ShortenRequest{Url: originalURL})
+	if err != nil {
+		panic(fmt.Errorf("shorten conflict: %w", err))
+	}
+	assert.True(t, resp2.GetConflict())
+
+	batch, err := client.ShortenBatch(authCtx, &pb.ShortenBatchRequest{Urls: []*pb.BatchItem{
+		{CorrelationId: "1", OriginalUrl: gofakeit.URL()},
+		{CorrelationId: "2", OriginalUrl: gofakeit.URL()},
+	}})
+	if err != nil {
+		panic(fmt.Errorf("shorten batch: %w", err))
+	}
+	assert.Len(t, batch.GetUrls(), 2)
+
+	short := strings.TrimPrefix(resp.GetResult(), config.Options.ShortURLHost+"/")
+	expand, err := client.Expand(ctx, &pb.ExpandRequest{ShortUrl: short})
+	if err != nil {
+		panic(fmt.Errorf("expand: %w", err))
+	}
+	assert.Equal(t, originalURL, expand.GetOriginalUrl())
+
+	_, err = client.Expand(ctx, &pb.ExpandRequest{ShortUrl: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err := client.ListUserURLs(authCtx, &pb.ListUserURLsRequest{})
+	if err != nil {
+		panic(fmt.Errorf("list: %w", err))
+	}
+	assert.Len(t, list.GetUrls(), 3)
+
+	_, err = client.DeleteUserURLs(authCtx, &pb.DeleteUserURLsRequest{ShortUrls: []string{short}})
+	assert.NoError(t, err)
+
+	// статистика сервиса не отдается ни без токена, ни с выданным анонимным токеном
+	_, err = client.Stats(ctx, &pb.StatsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.Stats(authCtx, &pb.StatsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// адрес ссылки с паролем не раскрывается
+	protected := &storage.URLData{OriginalURL: gofakeit.URL(), UserID: "owner"}
+	if err = protected.SetPassword("secret"); err != nil {
+		panic(err)
+	}
+	if err = storage.Stor.Post(ctx, protected); err != nil {
+		panic(err)
+	}
+	_, err = client.Expand(ctx, &pb.ExpandRequest{ShortUrl: protected.ShortURL})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// адрес ссылки с обязательной подписью не раскрывается
+	signed := &storage.URLData{OriginalURL: gofakeit.URL(), UserID: "owner", RequireSignature: true}
+	if err = storage.Stor.Post(ctx, signed); err != nil {
+		panic(err)
+	}
+	_, err = client.Expand(ctx, &pb.ExpandRequest{ShortUrl: signed.ShortURL})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// до активации раскрывается запасной адрес, без него адрес не раскрывается
+	launch := time.Now().Add(time.Hour)
+	scheduled := &storage.URLData{OriginalURL: gofakeit.URL(), NotBefore: &launch, FallbackURL: "https://example.com/soon"}
+	if err = storage.Stor.Post(ctx, scheduled); err != nil {
+		panic(err)
+	}
+	expand, err = client.Expand(ctx, &pb.ExpandRequest{ShortUrl: scheduled.ShortURL})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/soon", expand.GetOriginalUrl())
+	scheduled.FallbackURL = ""
+	assert.NoError(t, storage.Stor.UpdateUserURL(ctx, scheduled))
+	_, err = client.Expand(ctx, &pb.ExpandRequest{ShortUrl: scheduled.ShortURL})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.Ping(ctx, &pb.PingRequest{})
+	assert.NoError(t, err)
+}
+
+func Test_StatsTrustedSubnet(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	if err = storage.Stor.Post(context.Background(), &storage.URLData{OriginalURL: gofakeit.URL(), UserID: "stats-user"}); err != nil {
+		panic(err)
+	}
+	_, TrustedSubnet, err = net.ParseCIDR("10.0.0.0/24")
+	if err != nil {
+		panic(err)
+	}
+	defer func() { TrustedSubnet = nil }()
+	info := &grpc.UnaryServerInfo{FullMethod: pb.Shortener_Stats_FullMethodName}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return (&Server{}).Stats(ctx, req.(*pb.StatsRequest))
+	}
+
+	tests := []struct {
+		name     string
+		addr     string
+		wantCode codes.Code
+	}{
+		{"trusted", "10.0.0.5:4000", codes.OK},
+		{"untrusted", "192.168.1.5:4000", codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := net.ResolveTCPAddr("tcp", tt.addr)
+			if err != nil {
+				panic(err)
+			}
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+			resp, err := AuthInterceptor(ctx, &pb.StatsRequest{}, info, handler)
+			if !assert.Equal(t, tt.wantCode, status.Code(err)) {
+				panic(fmt.Errorf("code expect %v actual %v", tt.wantCode, status.Code(err)))
+			}
+			if tt.wantCode == codes.OK {
+				assert.Equal(t, int64(1), resp.(*pb.StatsResponse).GetUrls())
+			}
+		})
+	}
+}
+
+func Test_RateLimitInterceptor(t *testing.T) {
+	ratelimit.Lim = ratelimit.NewMemLimiter()
+	ratelimit.Limits = map[string]ratelimit.Limit{ratelimit.GroupBatch: {Rate: 0.001, Burst: 2}}
+	defer func() {
+		ratelimit.Lim = nil
+		ratelimit.Limits = map[string]ratelimit.Limit{}
+	}()
+	handler := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+
+	tests := []struct {
+		name          string
+		method        string
+		addr          string
+		userID        string
+		authenticated bool
+		wantCode      codes.Code
+	}{
+		{"first request", pb.Shortener_ShortenBatch_FullMethodName, "10.0.0.1:1000", "anon-1", false, codes.OK},
+		{"second anonymous token", pb.Shortener_ShortenBatch_FullMethodName, "10.0.0.1:1001", "anon-2", false, codes.OK},
+		{"over limit", pb.Shortener_ShortenBatch_FullMethodName, "10.0.0.1:1002", "anon-3", false, codes.ResourceExhausted},
+		{"other ip", pb.Shortener_ShortenBatch_FullMethodName, "10.0.0.2:1000", "anon-4", false, codes.OK},
+		{"user from limited ip", pb.Shortener_ShortenBatch_FullMethodName, "10.0.0.1:1003", "user-1", true, codes.OK},
+		{"method without limit", pb.Shortener_Ping_FullMethodName, "10.0.0.1:1004", "", false, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := net.ResolveTCPAddr("tcp", tt.addr)
+			if err != nil {
+				panic(err)
+			}
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+			ctx = context.WithValue(ctx, userIDKey{}, tt.userID)
+			if tt.authenticated {
+				ctx = context.WithValue(ctx, authenticatedKey{}, true)
+			}
+			_, err = RateLimitInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if !assert.Equal(t, tt.wantCode, status.Code(err)) {
+				panic(fmt.Errorf("code expect %v actual %v", tt.wantCode, status.Code(err)))
+			}
+			if tt.wantCode == codes.ResourceExhausted {
+				details := status.Convert(err).Details()
+				if assert.Len(t, details, 1) {
+					assert.Positive(t, details[0].(*errdetails.RetryInfo).GetRetryDelay().AsDuration())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/middleware"
+	"github.com/gerasimovpavel/shortener.git/internal/users"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+	"time"
+)
+
+// APIKeyRequest Запрос на создание API-ключа
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// APIKeyResponse Описание API-ключа. Key заполняется только при создании
+type APIKeyResponse struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Key       string     `json:"key,omitempty"`
+}
+
+// newAPIKeyResponse Описание ключа без хэша и владельца
+func newAPIKeyResponse(key *users.APIKey) *APIKeyResponse {
+	return &APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
+
+// CreateAPIKeyHandler Хендлер создания API-ключа пользователя
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nНе могу прочитать тело запроса", err.Error()), http.StatusBadRequest)
+		return
+	}
+	kr := new(APIKeyRequest)
+	err = json.Unmarshal(body, kr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nне могу десериализовать тело запроса", err.Error()), http.StatusBadRequest)
+		return
+	}
+	plain, key, err := users.NewAPIKey(middleware.UserIDFromContext(r.Context()), kr.Name, kr.Scopes)
+	if errors.Is(err, users.ErrBadScope) {
+		http.Error(w, fmt.Sprintf("%v, допустимые: %v", err, users.Scopes), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = users.Stor.CreateAPIKey(r.Context(), key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := newAPIKeyResponse(key)
+	resp.Key = plain
+	body, err = json.Marshal(resp)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nНе могу сериализовать json", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, string(body))
+}
+
+// ListAPIKeysHandler Хендлер получения API-ключей пользователя
+func ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := users.Stor.ListAPIKeys(r.Context(), middleware.UserIDFromContext(r.Context()))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("ошибка чтения: %v", err), http.StatusInternalServerError)
+		return
+	}
+	resp := make([]*APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, newAPIKeyResponse(key))
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nНе могу сериализовать в json", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(body))
+}
+
+// RevokeAPIKeyHandler Хендлер отзыва API-ключа пользователя
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	err := users.Stor.RevokeAPIKey(r.Context(), middleware.UserIDFromContext(r.Context()), chi.URLParam(r, "id"))
+	if errors.Is(err, users.ErrAPIKeyNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/brianvoe/gofakeit"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/internal/users"
+	"github.com/gerasimovpavel/shortener.git/pkg/cookies"
+	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
+	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxPasswordLen Максимальная длина пароля, которую принимает bcrypt
+const maxPasswordLen = 72
+
+// AuthRequest Запрос на регистрацию или вход
+type AuthRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// AuthResponse Ответ на регистрацию или вход
+type AuthResponse struct {
+	UserID string `json:"user_id"`
+}
+
+// readAuthRequest Чтение и проверка логина и пароля из тела запроса
+func readAuthRequest(w http.ResponseWriter, r *http.Request) (*AuthRequest, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nНе могу прочитать тело запроса", err.Error()), http.StatusBadRequest)
+		return nil, false
+	}
+	ar := new(AuthRequest)
+	err = json.Unmarshal(body, ar)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nне могу десериализовать тело запроса", err.Error()), http.StatusBadRequest)
+		return nil, false
+	}
+	ar.Login = strings.TrimSpace(ar.Login)
+	if ar.Login == "" || ar.Password == "" {
+		http.Error(w, "не указан логин или пароль", http.StatusBadRequest)
+		return nil, false
+	}
+	if len(ar.Password) > maxPasswordLen {
+		http.Error(w, fmt.Sprintf("пароль длиннее %d байт", maxPasswordLen), http.StatusBadRequest)
+		return nil, false
+	}
+	return ar, true
+}
+
+// anonymousUserID ID анонимного пользователя, с которым клиент пришел на вход.
+// Пустая строка, если токена нет, он не действителен или принадлежит зарегистрированному пользователю
+func anonymousUserID(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		cookie, err := r.Cookie(cookies.Name)
+		if err != nil {
+			return ""
+		}
+		token = cookie.Value
+	}
+	claims, err := crypt.ParseToken(strings.TrimPrefix(token, "Bearer "))
+	if err != nil || claims.Registered {
+		return ""
+	}
+	return claims.UserID
+}
+
+// claimAnonymousURL Передача ссылок анонимного пользователя в аккаунт userID.
+// Повторный вызов ничего не передает, каждая передача пишется в журнал аудита
+func claimAnonymousURL(r *http.Request, userID string) error {
+	anonID := anonymousUserID(r)
+	if anonID == "" || anonID == userID {
+		return nil
+	}
+	n, err := storage.Stor.TransferUserURL(r.Context(), anonID, userID)
+	if err != nil {
+		return err
+	}
+	logger.FromContext(r.Context()).Named("audit").Info("anonymous urls claimed",
+		zap.String("from_user_id", anonID),
+		zap.String("to_user_id", userID),
+		zap.Int("count", n),
+	)
+	return nil
+}
+
+// writeAuthResponse Выдача токена пользователю в куке и заголовке Authorization
+func writeAuthResponse(w http.ResponseWriter, userID string, status int) {
+	cookie, err := cookies.NewUserCookie(nil, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := json.Marshal(&AuthResponse{UserID: userID})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nНе могу сериализовать json", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, cookie)
+	w.Header().Set("Authorization", cookie.Value)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	io.WriteString(w, string(body))
+}
+
+// RegisterHandler Хендлер регистрации пользователя по логину и паролю
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	ar, ok := readAuthRequest(w, r)
+	if !ok {
+		return
+	}
+	user, err := users.NewUser(gofakeit.UUID(), ar.Login, ar.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = users.Stor.Create(r.Context(), user)
+	if errors.Is(err, users.ErrUserExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// пользователь уже создан, поэтому токен выдается и при ошибке переноса: повтор регистрации вернул бы 409.
+	// Ссылки перенесутся при следующем входе с тем же анонимным токеном
+	err = claimAnonymousURL(r, user.ID)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("failed to claim anonymous urls",
+			zap.String("user_id", user.ID),
+			zap.Error(err),
+		)
+	}
+	writeAuthResponse(w, user.ID, http.StatusCreated)
+}
+
+// LoginHandler Хендлер входа пользователя по логину и паролю
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	ar, ok := readAuthRequest(w, r)
+	if !ok {
+		return
+	}
+	user, err := users.Authenticate(r.Context(), users.Stor, ar.Login, ar.Password)
+	if errors.Is(err, users.ErrBadCredentials) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = claimAnonymousURL(r, user.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("не могу перенести ссылки: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeAuthResponse(w, user.ID, http.StatusOK)
+}
+
+// LogoutHandler Хендлер выхода: токен запроса отзывается, кука удаляется.
+// Повторный выход и выход без токена не считаются ошибкой
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		if cookie, err := r.Cookie(cookies.Name); err == nil {
+			token = cookie.Value
+		}
+	}
+	claims, err := crypt.ParseToken(token)
+	if err == nil && claims.ID != "" {
+		err = users.Stor.RevokeToken(r.Context(), claims.ID, claims.ExpiresAt.Time)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.FromContext(r.Context()).Named("audit").Info("token revoked",
+			zap.String("user_id", claims.UserID),
+			zap.String("jti", claims.ID),
+		)
+	}
+	http.SetCookie(w, cookies.ClearCookie())
+	w.WriteHeader(http.StatusNoContent)
+}
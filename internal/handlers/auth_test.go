@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/internal/users"
+	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_AuthHandlers(t *testing.T) {
+	config.Options.PassphraseKey = "LH;bjdsahlbhfu"
+	var err error
+	users.Stor, err = users.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+
+	tests := []struct {
+		name       string
+		hfunc      http.HandlerFunc
+		body       string
+		wantStatus int
+	}{
+		{"login unknown user", LoginHandler, `{"login":"alice","password":"secret"}`, http.StatusUnauthorized},
+		{"register empty password", RegisterHandler, `{"login":"alice","password":""}`, http.StatusBadRequest},
+		{"register bad json", RegisterHandler, `{"login":`, http.StatusBadRequest},
+		{"register", RegisterHandler, `{"login":"alice","password":"secret"}`, http.StatusCreated},
+		{"register duplicate", RegisterHandler, `{"login":"alice","password":"other"}`, http.StatusConflict},
+		{"login wrong password", LoginHandler, `{"login":"alice","password":"wrong"}`, http.StatusUnauthorized},
+		{"login", LoginHandler, `{"login":"alice","password":"secret"}`, http.StatusOK},
+	}
+	var registeredID string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/auth/", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			tt.hfunc(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if !assert.Equal(t, tt.wantStatus, resp.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, resp.StatusCode))
+			}
+			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+				return
+			}
+			claims, err := crypt.ParseToken(resp.Header.Get("Authorization"))
+			if err != nil {
+				panic(err)
+			}
+			assert.Len(t, resp.Cookies(), 1)
+			if registeredID == "" {
+				registeredID = claims.UserID
+			}
+			// вход возвращает того же пользователя, что и регистрация
+			assert.Equal(t, registeredID, claims.UserID)
+		})
+	}
+}
+
+func Test_ClaimAnonymousURL(t *testing.T) {
+	config.Options.PassphraseKey = "LH;bjdsahlbhfu"
+	var err error
+	users.Stor, err = users.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	ctx := context.Background()
+
+	anonToken, anon, err := crypt.BuildToken("anonymous-user")
+	if err != nil {
+		panic(err)
+	}
+	err = storage.Stor.Post(ctx, &storage.URLData{OriginalURL: "https://example.com/claim", UserID: anon.UserID})
+	if err != nil {
+		panic(err)
+	}
+
+	auth := func(hfunc http.HandlerFunc, token string) string {
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/", strings.NewReader(`{"login":"bob","password":"secret"}`))
+		r.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		hfunc(w, r)
+		resp := w.Result()
+		defer resp.Body.Close()
+		claims, err := crypt.ParseToken(resp.Header.Get("Authorization"))
+		if err != nil {
+			panic(fmt.Errorf("status %v: %w", resp.StatusCode, err))
+		}
+		assert.True(t, claims.Registered)
+		return claims.UserID
+	}
+
+	userID := auth(RegisterHandler, anonToken)
+	urls, err := storage.Stor.GetUserURL(ctx, userID)
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+
+	// повторный вход с тем же анонимным токеном ничего не меняет
+	assert.Equal(t, userID, auth(LoginHandler, anonToken))
+	urls, err = storage.Stor.GetUserURL(ctx, userID)
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+
+	// ссылки зарегистрированного пользователя не передаются другому аккаунту
+	registeredToken, _, err := crypt.BuildRegisteredToken(userID)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, "", anonymousUserID(func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		r.Header.Set("Authorization", registeredToken)
+		return r
+	}()))
+}
+
+// failingTransfer Хранилище ссылок, в котором не удается перенести ссылки
+type failingTransfer struct {
+	storage.Storage
+}
+
+// TransferUserURL Перенос ссылок всегда завершается ошибкой
+func (failingTransfer) TransferUserURL(context.Context, string, string) (int, error) {
+	return 0, errors.New("storage unavailable")
+}
+
+func Test_RegisterClaimFailure(t *testing.T) {
+	config.Options.PassphraseKey = "LH;bjdsahlbhfu"
+	var err error
+	users.Stor, err = users.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	mem, err := storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	storage.Stor = failingTransfer{mem}
+	anonToken, _, err := crypt.BuildToken("anonymous-user")
+	if err != nil {
+		panic(err)
+	}
+
+	// созданный пользователь получает токен, даже если ссылки перенести не удалось
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/register", strings.NewReader(`{"login":"carol","password":"secret"}`))
+	r.Header.Set("Authorization", anonToken)
+	w := httptest.NewRecorder()
+	RegisterHandler(w, r)
+	resp := w.Result()
+	defer resp.Body.Close()
+	if !assert.Equal(t, http.StatusCreated, resp.StatusCode) {
+		panic(fmt.Errorf("status expect %v actual %v", http.StatusCreated, resp.StatusCode))
+	}
+	claims, err := crypt.ParseToken(resp.Header.Get("Authorization"))
+	assert.NoError(t, err)
+	assert.True(t, claims.Registered)
+}
+
+func Test_LogoutHandler(t *testing.T) {
+	config.Options.PassphraseKey = "LH;bjdsahlbhfu"
+	var err error
+	users.Stor, err = users.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	token, claims, err := crypt.BuildRegisteredToken("logout-user")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, header := range []string{"Bearer " + token, ""} {
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+		r.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		LogoutHandler(w, r)
+		resp := w.Result()
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		if assert.Len(t, resp.Cookies(), 1) {
+			assert.Equal(t, -1, resp.Cookies()[0].MaxAge)
+		}
+	}
+	revoked, err := users.Stor.IsTokenRevoked(context.Background(), claims.ID)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
@@ -16,7 +16,7 @@ import (
 
 var Cookie *http.Cookie
 
-func auth(w http.ResponseWriter, r *http.Request) {
+func auth(w http.ResponseWriter, r *http.Request) *http.Request {
 	var err error
 	if Cookie == nil {
 		Cookie, _ = r.Cookie("UserID")
@@ -25,24 +25,21 @@ func auth(w http.ResponseWriter, r *http.Request) {
 			Cookie, err = cookies.NewCookie(Cookie)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
-				return
+				return r
 			}
 		}
 	}
 	if Cookie.Value == "" {
 		w.WriteHeader(http.StatusUnauthorized)
-		return
+		return r
 	}
-	middleware.UserID, err = crypt.Decrypt(Cookie.Value)
+	claims, err := crypt.ParseToken(Cookie.Value)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if Cookie.Value == "" {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return r
 	}
 	http.SetCookie(w, Cookie)
+	return r.WithContext(middleware.WithUserID(r.Context(), claims.UserID))
 }
 
 func BenchmarkPostHandler(b *testing.B) {
@@ -63,7 +60,7 @@ func BenchmarkPostHandler(b *testing.B) {
 
 			w := httptest.NewRecorder()
 
-			auth(w, r)
+			r = auth(w, r)
 			handler := http.HandlerFunc(PostHandler)
 
 			handler.ServeHTTP(w, r)
@@ -97,7 +94,7 @@ func BenchmarkPostJSONHandler(b *testing.B) {
 			r.Header.Add("Content-Type", "application/json")
 
 			w := httptest.NewRecorder()
-			auth(w, r)
+			r = auth(w, r)
 
 			handler := http.HandlerFunc(PostJSONHandler)
 
@@ -139,7 +136,7 @@ func BenchmarkPostJSONBatchHandler(b *testing.B) {
 			r.Header.Add("Content-Type", "application/json")
 
 			w := httptest.NewRecorder()
-			auth(w, r)
+			r = auth(w, r)
 
 			handler := http.HandlerFunc(PostJSONBatchHandler)
 
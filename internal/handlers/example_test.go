@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"github.com/brianvoe/gofakeit"
 	"github.com/gerasimovpavel/shortener.git/internal/storage"
@@ -11,7 +12,7 @@ import (
 )
 
 func saveURL(URL string) (string, error) {
-	storage.Stor.Post(&storage.URLData{OriginalURL: URL})
+	storage.Stor.Post(context.Background(), &storage.URLData{OriginalURL: URL})
 	return "", nil
 }
 func ExampleGetHandler() {
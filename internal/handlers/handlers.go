@@ -7,16 +7,33 @@ import (
 	"fmt"
 	"github.com/gerasimovpavel/shortener.git/internal/config"
 	"github.com/gerasimovpavel/shortener.git/internal/deleteuserurl"
+	"github.com/gerasimovpavel/shortener.git/internal/geoip"
 	"github.com/gerasimovpavel/shortener.git/internal/middleware"
+	"github.com/gerasimovpavel/shortener.git/internal/policy"
 	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
+	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"go.uber.org/zap"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // PostRequest Запрос на добавление ссылки
 type PostRequest struct {
-	URL string `json:"url"`
+	URL              string            `json:"url"`
+	RedirectCode     int               `json:"redirect_code,omitempty"`
+	CachePolicy      string            `json:"cache_policy,omitempty"`
+	Passthrough      bool              `json:"passthrough,omitempty"`
+	Rules            []storage.Rule    `json:"rules,omitempty"`
+	Variants         []storage.Variant `json:"variants,omitempty"`
+	Password         string            `json:"password,omitempty"`
+	MaxClicks        int               `json:"max_clicks,omitempty"`
+	NotBefore        *time.Time        `json:"not_before,omitempty"`
+	NotAfter         *time.Time        `json:"not_after,omitempty"`
+	FallbackURL      string            `json:"fallback_url,omitempty"`
+	RequireSignature bool              `json:"require_signature,omitempty"`
 }
 
 // PostResponse Ответ на запрос на добавление ссылки
@@ -26,7 +43,7 @@ type PostResponse struct {
 
 // PingHandler Хендлер для проверки работоспособности сервера
 func PingHandler(w http.ResponseWriter, r *http.Request) {
-	err := storage.Stor.Ping()
+	err := storage.Stor.Ping(r.Context())
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -50,19 +67,48 @@ func PostJSONBatchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	for _, data := range urls {
-		data.UserID = middleware.UserID
+		data.UserID = middleware.UserIDFromContext(r.Context())
+		// пароль задается только одиночной ссылке, хэш от клиента не принимается
+		data.PasswordHash, data.Protected = "", false
+		// остаток переходов новой ссылки равен ограничению
+		data.SetMaxClicks(data.MaxClicks)
+		data.OriginalURL, err = urlnorm.Normalize(data.OriginalURL)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", data.CorrID, err), http.StatusBadRequest)
+			return
+		}
+		if !checkPolicy(w, r, data.ShortURL, data.OriginalURL, data.CorrID) || !checkSettings(w, r, data) {
+			return
+		}
 	}
 
-	err = storage.Stor.PostBatch(urls)
-	if err != nil && !errors.Is(err, storage.ErrDataConflict) {
+	err = storage.Stor.PostBatch(r.Context(), urls)
+	if err != nil && !errors.Is(err, storage.ErrDataConflict) && !errors.Is(err, storage.ErrQuotaExceeded) {
 		http.Error(w, fmt.Sprintf("не могу добавить ссылки: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// элементы сверх квоты остаются без короткой ссылки, с ошибкой
+	var saved int
 	for _, data := range urls {
 		data.UUID = ""
 		data.OriginalURL = ""
 		data.UserID = ""
+		data.RedirectCode = 0
+		data.CachePolicy = ""
+		data.Passthrough = false
+		data.Rules = nil
+		data.Variants = nil
+		data.MaxClicks = 0
+		data.RemainingClicks = 0
+		data.NotBefore = nil
+		data.NotAfter = nil
+		data.FallbackURL = ""
+		data.RequireSignature = false
+		if data.Error != "" {
+			continue
+		}
+		saved++
 		data.ShortURL = fmt.Sprintf(`%s/%s`, config.Options.ShortURLHost, data.ShortURL)
 	}
 
@@ -70,6 +116,9 @@ func PostJSONBatchHandler(w http.ResponseWriter, r *http.Request) {
 	if errors.Is(err, storage.ErrDataConflict) {
 		status = http.StatusConflict
 	}
+	if saved == 0 && errors.Is(err, storage.ErrQuotaExceeded) {
+		status = http.StatusForbidden
+	}
 
 	body, err = json.Marshal(urls)
 	if err != nil {
@@ -97,13 +146,40 @@ func PostJSONHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	data := storage.URLData{}
 	data.OriginalURL = pr.URL
-	data.UserID = middleware.UserID
+	data.UserID = middleware.UserIDFromContext(r.Context())
+	data.RedirectCode = pr.RedirectCode
+	data.CachePolicy = pr.CachePolicy
+	data.Passthrough = pr.Passthrough
+	data.Rules = pr.Rules
+	data.Variants = pr.Variants
+	data.SetMaxClicks(pr.MaxClicks)
+	data.NotBefore = pr.NotBefore
+	data.NotAfter = pr.NotAfter
+	data.FallbackURL = pr.FallbackURL
+	data.RequireSignature = pr.RequireSignature
 
 	if data.OriginalURL == "" {
 		http.Error(w, "URL в теле не найден", http.StatusBadRequest)
 		return
 	}
-	err = storage.Stor.Post(&data)
+	data.OriginalURL, err = urlnorm.Normalize(data.OriginalURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkPolicy(w, r, data.ShortURL, data.OriginalURL, "") || !checkSettings(w, r, &data) {
+		return
+	}
+	err = data.SetPassword(pr.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = storage.Stor.Post(r.Context(), &data)
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil && !errors.Is(err, storage.ErrDataConflict) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -140,14 +216,26 @@ func PostHandler(w http.ResponseWriter, r *http.Request) {
 	data := storage.URLData{}
 	// Длинный URL
 	data.OriginalURL = string(body)
-	data.UserID = middleware.UserID
+	data.UserID = middleware.UserIDFromContext(r.Context())
 
 	if data.OriginalURL == "" {
 		http.Error(w, "URL в теле не найден", http.StatusBadRequest)
 		return
 	}
+	data.OriginalURL, err = urlnorm.Normalize(data.OriginalURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkPolicy(w, r, data.ShortURL, data.OriginalURL, "") {
+		return
+	}
 	//  СОхраняем в storage
-	err = storage.Stor.Post(&data)
+	err = storage.Stor.Post(r.Context(), &data)
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil && !errors.Is(err, storage.ErrDataConflict) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -168,14 +256,14 @@ func PostHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetHandler Хендлер для получения оригинальной ссылки
 func GetHandler(w http.ResponseWriter, r *http.Request) {
-	// Определям короткую ссылку из пути
-	shortURL := strings.TrimPrefix(r.URL.Path, "/")
+	// Определям короткую ссылку из пути, остаток пути присоединяется к ссылкам со сквозной передачей
+	shortURL, rest, _ := strings.Cut(strings.TrimLeft(r.URL.EscapedPath(), "/"), "/")
 	if shortURL == "" {
 		http.Error(w, "Ссылка не указана", http.StatusBadRequest)
 		return
 	}
 	// получаем оригинальный урл из мапы пар
-	data, err := storage.Stor.Get(shortURL)
+	data, err := storage.Stor.Get(r.Context(), shortURL)
 	// при ошибки возвращаем ошибку 500
 	if err != nil {
 		http.Error(w, fmt.Sprintf("ошибка чтения: %v", err), http.StatusInternalServerError)
@@ -186,16 +274,111 @@ func GetHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "url has been deleted", http.StatusGone)
 		return
 	}
-	// 307 редирект на оригинальный урл
-	http.Redirect(w, r, data.OriginalURL, http.StatusTemporaryRedirect)
+	// ссылка с обязательной подписью открывается только с действующей подписью
+	if data.RequireSignature && !checkSignature(w, r, data) {
+		return
+	}
+	// вне окна активности ссылка ведет на запасной адрес
+	if phase := data.Phase(time.Now()); data.OriginalURL != "" && phase != storage.PhaseActive {
+		writeOutsideWindow(w, r, data, phase)
+		return
+	}
+	if data.ClicksExhausted() {
+		http.Error(w, storage.ErrClicksExhausted.Error(), http.StatusGone)
+		return
+	}
+	if rest != "" && data.OriginalURL != "" && !data.Passthrough {
+		http.NotFound(w, r)
+		return
+	}
+	// ссылка с паролем открывается только с действующим доступом, иначе отдаем форму ввода пароля
+	if data.PasswordHash != "" && !passwordAllowed(r, data) {
+		writePasswordForm(w, http.StatusOK, "")
+		return
+	}
+	// адрес назначения выбирается правилами и вариантами ссылки, ответ зависит от заголовков и страны клиента
+	country := geoip.Lookup(middleware.ClientIP(r))
+	click := &storage.Click{ShortURL: data.ShortURL, Country: country.ISOCode, Time: time.Now()}
+	target, variant := data.Target(storage.Visit{
+		UserAgent:      r.UserAgent(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Country:        country,
+		Time:           click.Time,
+		Variant:        variantCookie(r, data.ShortURL),
+	})
+	if len(data.Rules) > 0 {
+		w.Header().Add("Vary", "User-Agent, Accept-Language")
+	}
+	if len(data.Variants) > 0 {
+		w.Header().Add("Vary", "Cookie")
+	}
+	// сохраненная ссылка могла попасть под обновленные списки
+	var violation *policy.Violation
+	if errors.As(policy.Current().CheckStored(r.Context(), target), &violation) {
+		writePolicyError(w, violation, "", http.StatusForbidden)
+		return
+	}
+	// ссылка на собственный домен не должна зацикливать переходы
+	err = policy.CheckChain(r.Context(), storage.Stor, data.ShortURL, target)
+	if errors.As(err, &violation) {
+		writePolicyError(w, violation, "", http.StatusLoopDetected)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("ошибка чтения: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if data.Passthrough {
+		// параметры подписи не передаются на адрес назначения
+		target, err = urlnorm.Join(target, rest, stripParams(r.URL.RawQuery, signatureParams...))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// переход по ссылке с ограничением списывается последним, когда все проверки пройдены.
+	// Остаток мог закончиться после чтения ссылки одновременными переходами
+	if data.MaxClicks > 0 {
+		_, err = storage.Stor.ConsumeClick(r.Context(), data.ShortURL)
+		if errors.Is(err, storage.ErrClicksExhausted) {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("ошибка записи: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if variant != "" {
+		setVariantCookie(w, data.ShortURL, variant)
+	}
+	// переход по существующей ссылке учитывается с вариантом и страной, ошибка учета переход не блокирует
+	click.Variant = variant
+	if data.OriginalURL != "" {
+		if err = storage.Stor.AddClick(r.Context(), click); err != nil {
+			logger.FromContext(r.Context()).Error("failed to record click", zap.String("short_url", data.ShortURL), zap.Error(err))
+		}
+	}
+	// редирект на оригинальный урл с кодом и кэшированием ссылки
+	code, cachePolicy := data.Redirect()
+	// кэшированный переход открывал бы ссылку с паролем без ввода пароля,
+	// обходил бы ограничение переходов, пережил бы окно активности и срок подписи
+	if data.PasswordHash != "" || data.MaxClicks > 0 || data.Scheduled() || data.RequireSignature {
+		cachePolicy = "no-store"
+	}
+	if cachePolicy != "" {
+		w.Header().Set("Cache-Control", cachePolicy)
+	}
+	http.Redirect(w, r, target, code)
 }
 
 // GetUserURLHandler Хендлер для получения ссылок пользователя
 func GetUserURLHandler(w http.ResponseWriter, r *http.Request) {
-	urls, err := storage.Stor.GetUserURL(middleware.UserID)
+	urls, err := storage.Stor.GetUserURL(r.Context(), middleware.UserIDFromContext(r.Context()))
 	for _, data := range urls {
 		data.UUID = ""
 		data.UserID = ""
+		data.HidePassword()
 		data.ShortURL = fmt.Sprintf(`%s/%s`, config.Options.ShortURLHost, data.ShortURL)
 	}
 	if err != nil {
@@ -247,5 +430,5 @@ func DeleteUserURLHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 	io.WriteString(w, "")
 
-	deleteuserurl.URLDel.AddURL(&s)
+	deleteuserurl.URLDel.AddURL(r.Context(), middleware.UserIDFromContext(r.Context()), &s)
 }
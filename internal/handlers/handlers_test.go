@@ -8,6 +8,7 @@ import (
 	"github.com/gerasimovpavel/shortener.git/internal/config"
 	"github.com/gerasimovpavel/shortener.git/internal/deleteuserurl"
 	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
 	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
 	"github.com/stretchr/testify/assert"
 	"io"
@@ -29,16 +30,16 @@ func Test_Handlers(t *testing.T) {
 		ShortURL      string `json:"short_url,omitempty"`
 	}{
 		{gofakeit.UUID(),
-			gofakeit.URL(),
+			fakeURL(),
 			""},
 		{gofakeit.UUID(),
-			gofakeit.URL(),
+			fakeURL(),
 			""},
 		{gofakeit.UUID(),
-			gofakeit.URL(),
+			fakeURL(),
 			""},
 		{gofakeit.UUID(),
-			gofakeit.URL(),
+			fakeURL(),
 			""},
 	}
 
@@ -330,7 +331,7 @@ func Test_Handlers(t *testing.T) {
 			req := httptest.NewRequest(tt.method, target, r)
 			w := httptest.NewRecorder()
 
-			userencrypt, err := crypt.Encrypt(tt.userID)
+			userencrypt, _, err := crypt.BuildToken(tt.userID)
 			if err != nil {
 				panic(err)
 			}
@@ -360,3 +361,13 @@ func Test_Handlers(t *testing.T) {
 		})
 	}
 }
+
+// fakeURL Случайная ссылка, проходящая проверку адреса: gofakeit иногда вставляет пробел в имя хоста
+func fakeURL() string {
+	for {
+		u := gofakeit.URL()
+		if _, err := urlnorm.Normalize(u); err == nil {
+			return u
+		}
+	}
+}
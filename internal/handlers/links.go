@@ -0,0 +1,228 @@
+// Package handlers реализует изменение настроек ссылок пользователя
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/middleware"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+	"time"
+)
+
+// URLPatch Изменяемые настройки ссылки. Отсутствующие поля не меняются
+type URLPatch struct {
+	RedirectCode *int               `json:"redirect_code"`
+	CachePolicy  *string            `json:"cache_policy"`
+	Passthrough  *bool              `json:"passthrough"`
+	Rules        *[]storage.Rule    `json:"rules"`
+	Variants     *[]storage.Variant `json:"variants"`
+	// Новый пароль ссылки, пустая строка снимает защиту
+	Password *string `json:"password"`
+	// Новое ограничение переходов, остаток переходов сбрасывается при его изменении
+	MaxClicks *int `json:"max_clicks"`
+	// Окно активности, null снимает границу
+	NotBefore nullableTime `json:"not_before"`
+	NotAfter  nullableTime `json:"not_after"`
+	// Запасной адрес, пустая строка его снимает
+	FallbackURL *string `json:"fallback_url"`
+	// Обязательная подпись ссылки
+	RequireSignature *bool `json:"require_signature"`
+}
+
+// nullableTime Время в изменении настроек: отличает отсутствующее поле от null
+type nullableTime struct {
+	set   bool
+	value *time.Time
+}
+
+// UnmarshalJSON Разбор времени или null
+func (t *nullableTime) UnmarshalJSON(b []byte) error {
+	t.set = true
+	return json.Unmarshal(b, &t.value)
+}
+
+// apply Применение изменений к ссылке
+func (p *URLPatch) apply(data *storage.URLData) {
+	if p.RedirectCode != nil {
+		data.RedirectCode = *p.RedirectCode
+	}
+	if p.CachePolicy != nil {
+		data.CachePolicy = *p.CachePolicy
+	}
+	if p.Passthrough != nil {
+		data.Passthrough = *p.Passthrough
+	}
+	if p.Rules != nil {
+		data.Rules = *p.Rules
+	}
+	if p.Variants != nil {
+		data.Variants = *p.Variants
+	}
+	if p.MaxClicks != nil && *p.MaxClicks != data.MaxClicks {
+		data.SetMaxClicks(*p.MaxClicks)
+	}
+	if p.NotBefore.set {
+		data.NotBefore = p.NotBefore.value
+	}
+	if p.NotAfter.set {
+		data.NotAfter = p.NotAfter.value
+	}
+	if p.FallbackURL != nil {
+		data.FallbackURL = *p.FallbackURL
+	}
+	if p.RequireSignature != nil {
+		data.RequireSignature = *p.RequireSignature
+	}
+}
+
+// applyPassword Применение нового пароля ссылки
+func (p *URLPatch) applyPassword(data *storage.URLData) error {
+	if p.Password == nil {
+		return nil
+	}
+	return data.SetPassword(*p.Password)
+}
+
+// checkSettings Проверка настроек ссылки: перенаправления, правил, вариантов, их адресов назначения,
+// ограничения переходов и окна активности.
+// При ошибке пишет ответ и возвращает false
+func checkSettings(w http.ResponseWriter, r *http.Request, data *storage.URLData) bool {
+	err := storage.ValidateRedirect(data.RedirectCode, data.CachePolicy)
+	if err == nil {
+		err = storage.ValidateRules(data.Rules)
+	}
+	if err == nil {
+		err = storage.ValidateVariants(data.Variants)
+	}
+	if err == nil {
+		err = storage.ValidateMaxClicks(data.MaxClicks)
+	}
+	if err == nil {
+		err = storage.ValidateSchedule(data)
+	}
+	if err != nil {
+		if data.CorrID != "" {
+			err = fmt.Errorf("%s: %w", data.CorrID, err)
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	for _, rule := range data.Rules {
+		if !checkPolicy(w, r, data.ShortURL, rule.Target, data.CorrID) {
+			return false
+		}
+	}
+	for _, variant := range data.Variants {
+		if !checkPolicy(w, r, data.ShortURL, variant.Target, data.CorrID) {
+			return false
+		}
+	}
+	if data.FallbackURL != "" && !checkPolicy(w, r, data.ShortURL, data.FallbackURL, data.CorrID) {
+		return false
+	}
+	return true
+}
+
+// userURL Ссылка текущего пользователя из пути запроса. nil, если ответ уже записан
+func userURL(w http.ResponseWriter, r *http.Request) *storage.URLData {
+	data, err := storage.Stor.Get(r.Context(), chi.URLParam(r, "shortURL"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("ошибка чтения: %v", err), http.StatusInternalServerError)
+		return nil
+	}
+	userID := middleware.UserIDFromContext(r.Context())
+	if data.OriginalURL == "" || data.DeletedFlag || userID == "" || data.UserID != userID {
+		http.Error(w, storage.ErrURLNotFound.Error(), http.StatusNotFound)
+		return nil
+	}
+	return data
+}
+
+// writeUserURL Ответ со ссылкой пользователя
+func writeUserURL(w http.ResponseWriter, data *storage.URLData) {
+	data.UUID = ""
+	data.UserID = ""
+	data.HidePassword()
+	data.ShortURL = fmt.Sprintf(`%s/%s`, config.Options.ShortURLHost, data.ShortURL)
+	body, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nНе могу сериализовать в json", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(body))
+}
+
+// GetUserURLByShortHandler Хендлер для получения ссылки пользователя с настройками
+func GetUserURLByShortHandler(w http.ResponseWriter, r *http.Request) {
+	data := userURL(w, r)
+	if data == nil {
+		return
+	}
+	writeUserURL(w, data)
+}
+
+// PatchUserURLHandler Хендлер для изменения настроек ссылки пользователя
+func PatchUserURLHandler(w http.ResponseWriter, r *http.Request) {
+	data := userURL(w, r)
+	if data == nil {
+		return
+	}
+
+	patch := new(URLPatch)
+	err := json.NewDecoder(r.Body).Decode(patch)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nне могу десериализовать тело запроса", err.Error()), http.StatusBadRequest)
+		return
+	}
+	patch.apply(data)
+	if !checkSettings(w, r, data) {
+		return
+	}
+	err = patch.applyPassword(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = storage.Stor.UpdateUserURL(r.Context(), data)
+	if errors.Is(err, storage.ErrURLNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("не могу изменить ссылку: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeUserURL(w, data)
+}
+
+// GetUserURLStatsHandler Хендлер для получения статистики переходов по ссылке пользователя
+func GetUserURLStatsHandler(w http.ResponseWriter, r *http.Request) {
+	data := userURL(w, r)
+	if data == nil {
+		return
+	}
+	stats, err := storage.Stor.ClickStats(r.Context(), data.ShortURL)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("ошибка чтения: %v", err), http.StatusInternalServerError)
+		return
+	}
+	body, err := json.Marshal(stats)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nНе могу сериализовать в json", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(body))
+}
@@ -0,0 +1,582 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/geoip"
+	"github.com/gerasimovpavel/shortener.git/internal/middleware"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_PatchUserURL(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	config.Options.RedirectCode = http.StatusFound
+	config.Options.RedirectCachePolicy = "no-store"
+	defer func() {
+		config.Options.RedirectCode = 0
+		config.Options.RedirectCachePolicy = ""
+	}()
+	userID := "patch-user"
+	data := &storage.URLData{OriginalURL: "https://example.com/", UserID: userID}
+	if err = storage.Stor.Post(context.Background(), data); err != nil {
+		panic(err)
+	}
+	router := chi.NewRouter()
+	router.Get("/{shortURL}", GetHandler)
+	router.Patch("/api/user/urls/{shortURL}", PatchUserURLHandler)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		userID      string
+		wantStatus  int
+		wantCache   string
+		wantLocated bool
+	}{
+		{"server default", http.MethodGet, "/" + data.ShortURL, "", userID, http.StatusFound, "no-store", true},
+		{"bad code", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"redirect_code":200}`, userID, http.StatusBadRequest, "", false},
+		{"bad cache policy", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"cache_policy":"forever"}`, userID, http.StatusBadRequest, "", false},
+		{"other user", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"redirect_code":301}`, "intruder", http.StatusNotFound, "", false},
+		{"unknown link", http.MethodPatch, "/api/user/urls/unknown", `{"redirect_code":301}`, userID, http.StatusNotFound, "", false},
+		{"permanent", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"redirect_code":308,"cache_policy":"public, max-age=3600"}`, userID, http.StatusOK, "", false},
+		{"permanent redirect", http.MethodGet, "/" + data.ShortURL, "", userID, http.StatusPermanentRedirect, "public, max-age=3600", true},
+		{"reset cache policy", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"cache_policy":""}`, userID, http.StatusOK, "", false},
+		{"code kept", http.MethodGet, "/" + data.ShortURL, "", userID, http.StatusPermanentRedirect, "no-store", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r = r.WithContext(middleware.WithUserID(r.Context(), tt.userID))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if !assert.Equal(t, tt.wantStatus, resp.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, resp.StatusCode))
+			}
+			assert.Equal(t, tt.wantCache, resp.Header.Get("Cache-Control"))
+			if tt.wantLocated {
+				assert.Equal(t, data.OriginalURL, resp.Header.Get("Location"))
+			}
+		})
+	}
+}
+
+func Test_Passthrough(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	userID := "passthrough-user"
+	section := &storage.URLData{OriginalURL: "https://example.com/docs?lang=ru", UserID: userID, Passthrough: true}
+	plain := &storage.URLData{OriginalURL: "https://example.com/plain", UserID: userID}
+	for _, data := range []*storage.URLData{section, plain} {
+		if err = storage.Stor.Post(context.Background(), data); err != nil {
+			panic(err)
+		}
+	}
+	router := chi.NewRouter()
+	router.Use(asUser(userID))
+	router.Get("/{shortURL}", GetHandler)
+	router.Get("/{shortURL}/*", GetHandler)
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"section root", "/" + section.ShortURL, http.StatusTemporaryRedirect, "https://example.com/docs?lang=ru"},
+		{"section page", "/" + section.ShortURL + "/guide/page?x=1&lang=en", http.StatusTemporaryRedirect, "https://example.com/docs/guide/page?lang=ru&x=1"},
+		{"section traversal", "/" + section.ShortURL + "/%2e%2e/admin", http.StatusBadRequest, ""},
+		{"plain query ignored", "/" + plain.ShortURL + "?x=1", http.StatusTemporaryRedirect, "https://example.com/plain"},
+		{"plain with path", "/" + plain.ShortURL + "/page", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if !assert.Equal(t, tt.wantStatus, resp.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, resp.StatusCode))
+			}
+			assert.Equal(t, tt.wantLocation, resp.Header.Get("Location"))
+		})
+	}
+}
+
+func Test_Rules(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	config.Options.ShortURLHost = "http://localhost:8080"
+	config.Options.RedirectMaxDepth = 5
+	defer func() {
+		config.Options.ShortURLHost = ""
+		config.Options.RedirectMaxDepth = 0
+	}()
+	userID := "rules-user"
+	data := &storage.URLData{OriginalURL: "https://example.com/", UserID: userID}
+	if err = storage.Stor.Post(context.Background(), data); err != nil {
+		panic(err)
+	}
+	router := chi.NewRouter()
+	router.Use(asUser(userID))
+	router.Get("/{shortURL}", GetHandler)
+	router.Get("/api/user/urls/{shortURL}", GetUserURLByShortHandler)
+	router.Patch("/api/user/urls/{shortURL}", PatchUserURLHandler)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		userAgent    string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"bad rule", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"rules":[{"device":["tv"],"target":"https://example.com/tv"}]}`, "", http.StatusBadRequest, ""},
+		{"rule to itself", http.MethodPatch, "/api/user/urls/" + data.ShortURL,
+			`{"rules":[{"device":["ios"],"target":"http://localhost:8080/` + data.ShortURL + `"}]}`,
+			"", http.StatusUnprocessableEntity, ""},
+		{"set rules", http.MethodPatch, "/api/user/urls/" + data.ShortURL,
+			`{"rules":[{"device":["ios"],"target":"https://apps.apple.com/app"},{"device":["android"],"target":"https://play.google.com/app"}]}`,
+			"", http.StatusOK, ""},
+		{"read rules", http.MethodGet, "/api/user/urls/" + data.ShortURL, "", "", http.StatusOK, ""},
+		{"ios", http.MethodGet, "/" + data.ShortURL, "", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", http.StatusTemporaryRedirect, "https://apps.apple.com/app"},
+		{"android", http.MethodGet, "/" + data.ShortURL, "", "Mozilla/5.0 (Linux; Android 14)", http.StatusTemporaryRedirect, "https://play.google.com/app"},
+		{"web", http.MethodGet, "/" + data.ShortURL, "", "Mozilla/5.0 (X11; Linux x86_64)", http.StatusTemporaryRedirect, "https://example.com/"},
+		{"remove rules", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"rules":[]}`, "", http.StatusOK, ""},
+		{"ios after removal", http.MethodGet, "/" + data.ShortURL, "", "Mozilla/5.0 (iPhone)", http.StatusTemporaryRedirect, "https://example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("User-Agent", tt.userAgent)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if !assert.Equal(t, tt.wantStatus, resp.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, resp.StatusCode))
+			}
+			assert.Equal(t, tt.wantLocation, resp.Header.Get("Location"))
+			if tt.name == "read rules" {
+				got := new(storage.URLData)
+				if err := json.NewDecoder(resp.Body).Decode(got); err != nil {
+					panic(err)
+				}
+				assert.Len(t, got.Rules, 2)
+			}
+		})
+	}
+}
+
+func Test_Variants(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	userID := "variants-user"
+	data := &storage.URLData{OriginalURL: "https://example.com/", UserID: userID}
+	if err = storage.Stor.Post(context.Background(), data); err != nil {
+		panic(err)
+	}
+	router := chi.NewRouter()
+	router.Use(asUser(userID))
+	router.Get("/{shortURL}", GetHandler)
+	router.Get("/api/user/urls/{shortURL}/stats", GetUserURLStatsHandler)
+	router.Patch("/api/user/urls/{shortURL}", PatchUserURLHandler)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		sticky       string
+		wantStatus   int
+		wantLocation string
+		wantCookie   string
+	}{
+		{"bad variants", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"variants":[{"name":"a","target":"https://example.com/a","weight":0}]}`, "", http.StatusBadRequest, "", ""},
+		{"set variants", http.MethodPatch, "/api/user/urls/" + data.ShortURL,
+			`{"variants":[{"name":"a","target":"https://example.com/a","weight":1},{"name":"b","target":"https://example.com/b","weight":0}]}`,
+			"", http.StatusOK, "", ""},
+		{"new visitor", http.MethodGet, "/" + data.ShortURL, "", "", http.StatusTemporaryRedirect, "https://example.com/a", "a"},
+		{"sticky visitor", http.MethodGet, "/" + data.ShortURL, "", "b", http.StatusTemporaryRedirect, "https://example.com/b", "b"},
+		{"repeat visitor", http.MethodGet, "/" + data.ShortURL, "", "a", http.StatusTemporaryRedirect, "https://example.com/a", "a"},
+		{"stats", http.MethodGet, "/api/user/urls/" + data.ShortURL + "/stats", "", "", http.StatusOK, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.sticky != "" {
+				r.AddCookie(&http.Cookie{Name: variantCookiePrefix + data.ShortURL, Value: tt.sticky})
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if !assert.Equal(t, tt.wantStatus, resp.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, resp.StatusCode))
+			}
+			assert.Equal(t, tt.wantLocation, resp.Header.Get("Location"))
+			if tt.wantCookie != "" {
+				cookies := resp.Cookies()
+				if assert.Len(t, cookies, 1) {
+					assert.Equal(t, tt.wantCookie, cookies[0].Value)
+				}
+			}
+			if tt.name == "stats" {
+				stats := new(storage.ClickStats)
+				if err := json.NewDecoder(resp.Body).Decode(stats); err != nil {
+					panic(err)
+				}
+				assert.Equal(t, &storage.ClickStats{Clicks: 3, Variants: map[string]int{"a": 2, "b": 1}}, stats)
+			}
+		})
+	}
+}
+
+func Test_GeoRules(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	geoip.DB, err = geoip.Open("../geoip/testdata/country.mmdb")
+	if err != nil {
+		panic(err)
+	}
+	middleware.TrustedProxies, err = middleware.ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		geoip.DB.Close()
+		geoip.DB = nil
+		middleware.TrustedProxies = nil
+	}()
+	data := &storage.URLData{
+		OriginalURL: "https://example.com/",
+		UserID:      "geo-user",
+		Rules:       []storage.Rule{{Country: []string{geoip.EU}, Target: "https://example.com/gdpr"}},
+	}
+	if err = storage.Stor.Post(context.Background(), data); err != nil {
+		panic(err)
+	}
+	router := chi.NewRouter()
+	router.Get("/{shortURL}", GetHandler)
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		wantLocation string
+	}{
+		{"eu visitor behind proxy", "10.0.0.1:1000", "2.125.160.216", "https://example.com/gdpr"},
+		{"uk visitor behind proxy", "10.0.0.1:1000", "81.2.69.142", "https://example.com/"},
+		{"spoofed header", "216.160.83.56:1000", "89.160.20.112", "https://example.com/"},
+		{"direct eu visitor", "89.160.20.112:1000", "", "https://example.com/gdpr"},
+		{"unknown address", "10.0.0.1:1000", "", "https://example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/"+data.ShortURL, nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if !assert.Equal(t, tt.wantLocation, resp.Header.Get("Location")) {
+				panic(fmt.Errorf("location expect %v actual %v", tt.wantLocation, resp.Header.Get("Location")))
+			}
+		})
+	}
+	// переходы учитываются по странам клиентов
+	stats, err := storage.Stor.ClickStats(context.Background(), data.ShortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, &storage.ClickStats{Clicks: 5, Countries: map[string]int{"DE": 1, "GB": 1, "US": 1, "SE": 1}}, stats)
+}
+
+func Test_MaxClicks(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	userID := "max-clicks-user"
+	data := &storage.URLData{OriginalURL: "https://example.com/download", UserID: userID}
+	data.SetMaxClicks(1)
+	if err = storage.Stor.Post(context.Background(), data); err != nil {
+		panic(err)
+	}
+	router := chi.NewRouter()
+	router.Use(asUser(userID))
+	router.Get("/{shortURL}", GetHandler)
+	router.Patch("/api/user/urls/{shortURL}", PatchUserURLHandler)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"first download", http.MethodGet, "/" + data.ShortURL, "", http.StatusTemporaryRedirect, ""},
+		{"link used", http.MethodGet, "/" + data.ShortURL, "", http.StatusGone, ""},
+		{"bad limit", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"max_clicks":-1}`, http.StatusBadRequest, ""},
+		{"other setting", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"cache_policy":"private"}`, http.StatusOK, `"max_clicks":1`},
+		{"still used", http.MethodGet, "/" + data.ShortURL, "", http.StatusGone, ""},
+		{"new limit", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"max_clicks":2}`, http.StatusOK, `"remaining_clicks":2`},
+		{"second download", http.MethodGet, "/" + data.ShortURL, "", http.StatusTemporaryRedirect, ""},
+		{"third download", http.MethodGet, "/" + data.ShortURL, "", http.StatusTemporaryRedirect, ""},
+		{"limit reached", http.MethodGet, "/" + data.ShortURL, "", http.StatusGone, ""},
+		{"unlimited", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"max_clicks":0}`, http.StatusOK, ""},
+		{"open again", http.MethodGet, "/" + data.ShortURL, "", http.StatusTemporaryRedirect, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if !assert.Equal(t, tt.wantStatus, resp.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, resp.StatusCode))
+			}
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+			if tt.wantStatus == http.StatusTemporaryRedirect && tt.name != "open again" {
+				assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func Test_Schedule(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	userID := "schedule-user"
+	config.Options.FallbackURL = "https://example.com/expired"
+	defer func() { config.Options.FallbackURL = "" }()
+
+	future := time.Date(2100, 1, 1, 10, 0, 0, 0, time.UTC)
+	past := time.Date(2000, 1, 1, 10, 0, 0, 0, time.UTC)
+	links := map[string]*storage.URLData{
+		"pending":          {OriginalURL: "https://example.com/launch", NotBefore: &future},
+		"pending fallback": {OriginalURL: "https://example.com/launch2", NotBefore: &future, FallbackURL: "https://example.com/teaser"},
+		"ended":            {OriginalURL: "https://example.com/sale", NotAfter: &past},
+		"ended fallback":   {OriginalURL: "https://example.com/sale2", NotAfter: &past, FallbackURL: "https://example.com/next-sale"},
+		"active":           {OriginalURL: "https://example.com/now", NotBefore: &past, NotAfter: &future},
+	}
+	for _, data := range links {
+		data.UserID = userID
+		if err = storage.Stor.Post(context.Background(), data); err != nil {
+			panic(err)
+		}
+	}
+	router := chi.NewRouter()
+	router.Use(asUser(userID))
+	router.Get("/{shortURL}", GetHandler)
+	router.Patch("/api/user/urls/{shortURL}", PatchUserURLHandler)
+
+	tests := []struct {
+		name         string
+		method       string
+		link         string
+		body         string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+		wantCache    string
+	}{
+		{"coming soon", http.MethodGet, "pending", "", http.StatusOK, "", "01.01.2100 10:00 UTC", "no-store"},
+		{"teaser before launch", http.MethodGet, "pending fallback", "", http.StatusTemporaryRedirect, "https://example.com/teaser", "", "no-store"},
+		{"server fallback after end", http.MethodGet, "ended", "", http.StatusTemporaryRedirect, "https://example.com/expired", "", "no-store"},
+		{"own fallback after end", http.MethodGet, "ended fallback", "", http.StatusTemporaryRedirect, "https://example.com/next-sale", "", "no-store"},
+		{"inside window", http.MethodGet, "active", "", http.StatusTemporaryRedirect, "https://example.com/now", "", "no-store"},
+		{"bad window", http.MethodPatch, "pending", `{"not_after":"2000-01-01T00:00:00Z"}`, http.StatusBadRequest, "", "", ""},
+		{"launch now", http.MethodPatch, "pending", `{"not_before":null}`, http.StatusOK, "", "", ""},
+		{"launched", http.MethodGet, "pending", "", http.StatusTemporaryRedirect, "https://example.com/launch", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/" + links[tt.link].ShortURL
+			if tt.method == http.MethodPatch {
+				path = "/api/user/urls" + path
+			}
+			r := httptest.NewRequest(tt.method, path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if !assert.Equal(t, tt.wantStatus, resp.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v\nbody %s", tt.wantStatus, resp.StatusCode, w.Body))
+			}
+			assert.Equal(t, tt.wantLocation, resp.Header.Get("Location"))
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+			// ответы по ссылкам с окном активности не кэшируются
+			if tt.method == http.MethodGet {
+				assert.Equal(t, tt.wantCache, resp.Header.Get("Cache-Control"))
+			}
+		})
+	}
+
+	// без запасных адресов закончившаяся ссылка отдает 410
+	config.Options.FallbackURL = ""
+	r := httptest.NewRequest(http.MethodGet, "/"+links["ended"].ShortURL, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	// страница ожидания задается шаблоном
+	filename := filepath.Join(t.TempDir(), "soon.html")
+	if err = os.WriteFile(filename, []byte(`Скоро: {{.ShortURL}} {{.NotBefore.Year}}`), 0644); err != nil {
+		panic(err)
+	}
+	defer func(t *template.Template) { comingSoon = t }(comingSoon)
+	assert.NoError(t, LoadComingSoon(filename))
+	r = httptest.NewRequest(http.MethodGet, "/"+links["pending fallback"].ShortURL, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	links["pending fallback"].FallbackURL = ""
+	assert.NoError(t, storage.Stor.UpdateUserURL(context.Background(), links["pending fallback"]))
+	r = httptest.NewRequest(http.MethodGet, "/"+links["pending fallback"].ShortURL, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, "Скоро: "+links["pending fallback"].ShortURL+" 2100", w.Body.String())
+}
+
+func Test_SignedURL(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	userID := "signed-user"
+	config.Options.PassphraseKey = "signed test key"
+	config.Options.SignedURLTTL = time.Hour
+	config.Options.SignedURLMaxTTL = 24 * time.Hour
+	defer crypt.SetKeyring(nil)
+
+	signed := &storage.URLData{OriginalURL: "https://example.com/docs", UserID: userID, RequireSignature: true, Passthrough: true}
+	plain := &storage.URLData{OriginalURL: "https://example.com/public", UserID: userID}
+	for _, data := range []*storage.URLData{signed, plain} {
+		if err = storage.Stor.Post(context.Background(), data); err != nil {
+			panic(err)
+		}
+	}
+	router := chi.NewRouter()
+	router.Use(asUser(userID))
+	router.Get("/{shortURL}", GetHandler)
+	router.Get("/{shortURL}/*", GetHandler)
+	router.Post("/api/user/urls/{shortURL}/sign", SignUserURLHandler)
+
+	sign := func(shortURL, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/user/urls/"+shortURL+"/sign", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	assert.Equal(t, http.StatusBadRequest, sign(plain.ShortURL, "").Code)
+	assert.Equal(t, http.StatusBadRequest, sign(signed.ShortURL, `{"ttl":"48h"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, sign(signed.ShortURL, `{"expires_at":"2000-01-01T00:00:00Z"}`).Code)
+	assert.Equal(t, http.StatusNotFound, sign("missing", "").Code)
+	w := sign(signed.ShortURL, "")
+	if !assert.Equal(t, http.StatusOK, w.Code) {
+		panic(fmt.Errorf("status expect %v actual %v\nbody %s", http.StatusOK, w.Code, w.Body))
+	}
+	var sr SignResponse
+	if err = json.Unmarshal(w.Body.Bytes(), &sr); err != nil {
+		panic(err)
+	}
+	assert.WithinDuration(t, time.Now().Add(time.Hour), sr.ExpiresAt, time.Minute)
+	_, query, _ := strings.Cut(sr.URL, "?")
+	assert.Equal(t, config.Options.ShortURLHost+"/"+signed.ShortURL+"?"+query, sr.URL)
+	expired, err := crypt.SignURL(signed.ShortURL, time.Now().Add(-time.Minute))
+	if err != nil {
+		panic(err)
+	}
+	expiredQuery := fmt.Sprintf("exp=%d&sig=%s", time.Now().Add(-time.Minute).Unix(), expired)
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"valid", "/" + signed.ShortURL + "?" + query, http.StatusTemporaryRedirect, "https://example.com/docs"},
+		{"passthrough without signature params", "/" + signed.ShortURL + "/guide?page=2&" + query + "&lang=ru", http.StatusTemporaryRedirect, "https://example.com/docs/guide?page=2&lang=ru"},
+		{"no signature", "/" + signed.ShortURL, http.StatusForbidden, ""},
+		{"tampered", "/" + signed.ShortURL + "?" + strings.Replace(query, "exp=", "exp=1", 1), http.StatusForbidden, ""},
+		{"other link", "/" + plain.ShortURL + "?" + query, http.StatusTemporaryRedirect, "https://example.com/public"},
+		{"expired", "/" + signed.ShortURL + "?" + expiredQuery, http.StatusGone, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if !assert.Equal(t, tt.wantStatus, resp.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v\nbody %s", tt.wantStatus, resp.StatusCode, w.Body))
+			}
+			assert.Equal(t, tt.wantLocation, resp.Header.Get("Location"))
+		})
+	}
+	// ответы по ссылке с подписью не кэшируются
+	r := httptest.NewRequest(http.MethodGet, "/"+signed.ShortURL+"?"+query, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+}
+
+// asUser Посредник, авторизующий все запросы пользователем userID
+func asUser(userID string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(middleware.WithUserID(r.Context(), userID)))
+		})
+	}
+}
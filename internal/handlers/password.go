@@ -0,0 +1,120 @@
+// Package handlers реализует доступ к ссылкам, защищенным паролем
+package handlers
+
+import (
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/metrics"
+	"github.com/gerasimovpavel/shortener.git/internal/middleware"
+	"github.com/gerasimovpavel/shortener.git/internal/ratelimit"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
+	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"go.uber.org/zap"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// passwordCookiePrefix Префикс имени куки доступа к ссылке с паролем
+const passwordCookiePrefix = "pw_"
+
+// passwordForm Форма ввода пароля, отправляется на адрес перехода
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Ссылка защищена паролем</title>
+</head>
+<body>
+<form method="post">
+<p>Ссылка защищена паролем</p>
+{{if .}}<p role="alert">{{.}}</p>
+{{end}}<input type="password" name="password" autofocus required>
+<button type="submit">Перейти</button>
+</form>
+</body>
+</html>
+`))
+
+// writePasswordForm Ответ с формой ввода пароля и сообщением message
+func writePasswordForm(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	passwordForm.Execute(w, message)
+}
+
+// passwordAllowed Есть ли у посетителя действующий доступ к ссылке с паролем
+func passwordAllowed(r *http.Request, data *storage.URLData) bool {
+	cookie, err := r.Cookie(passwordCookiePrefix + data.ShortURL)
+	if err != nil {
+		return false
+	}
+	return crypt.ParseLinkToken(cookie.Value, data.ShortURL, data.PasswordFingerprint()) == nil
+}
+
+// allowPasswordAttempt Ограничение попыток ввода пароля ссылки с одного IP.
+// Верный пароль вводится раз за время действия доступа, поэтому ограничиваются в основном неудачные попытки.
+// При превышении пишет ответ и возвращает false. Ошибка хранилища ограничителя попытку не блокирует
+func allowPasswordAttempt(w http.ResponseWriter, r *http.Request, shortURL string) bool {
+	limit := ratelimit.Limits[ratelimit.GroupPassword]
+	if ratelimit.Lim == nil || !limit.Enabled() {
+		return true
+	}
+	key := ratelimit.GroupPassword + ":" + shortURL + ":ip:" + middleware.ClientIP(r)
+	ok, retry, err := ratelimit.Lim.Allow(r.Context(), key, limit)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("rate limiter failed", zap.String("group", ratelimit.GroupPassword), zap.Error(err))
+		return true
+	}
+	if !ok {
+		metrics.RateLimited.WithLabelValues(ratelimit.GroupPassword).Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(retry.Seconds())))))
+		writePasswordForm(w, http.StatusTooManyRequests, "Слишком много попыток, повторите позже")
+		return false
+	}
+	return true
+}
+
+// PasswordHandler Хендлер проверки пароля ссылки. При верном пароле выдает куку доступа
+// и возвращает посетителя на адрес перехода
+func PasswordHandler(w http.ResponseWriter, r *http.Request) {
+	shortURL, _, _ := strings.Cut(strings.TrimLeft(r.URL.EscapedPath(), "/"), "/")
+	data, err := storage.Stor.Get(r.Context(), shortURL)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("ошибка чтения: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if data.OriginalURL == "" || data.DeletedFlag || data.PasswordHash == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !allowPasswordAttempt(w, r, data.ShortURL) {
+		return
+	}
+	if !data.CheckPassword(r.PostFormValue("password")) {
+		writePasswordForm(w, http.StatusUnauthorized, "Неверный пароль")
+		return
+	}
+
+	token, err := crypt.BuildLinkToken(data.ShortURL, data.PasswordFingerprint(), config.Options.LinkPasswordTTL)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("не могу выдать доступ: %v", err), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     passwordCookiePrefix + data.ShortURL,
+		Value:    token,
+		Path:     "/" + data.ShortURL,
+		MaxAge:   int(config.Options.LinkPasswordTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   config.Options.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	// лишние слэши в начале пути дали бы адрес на другой хост
+	http.Redirect(w, r, "/"+strings.TrimLeft(r.URL.RequestURI(), "/"), http.StatusSeeOther)
+}
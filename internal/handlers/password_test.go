@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/ratelimit"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Password(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	config.Options.PassphraseKey = "password test key"
+	config.Options.LinkPasswordTTL = time.Minute
+	ratelimit.Lim = ratelimit.NewMemLimiter()
+	ratelimit.Limits = map[string]ratelimit.Limit{ratelimit.GroupPassword: {Rate: 0.001, Burst: 3}}
+	defer func() {
+		ratelimit.Lim = nil
+		ratelimit.Limits = map[string]ratelimit.Limit{}
+	}()
+	userID := "password-user"
+	data := &storage.URLData{OriginalURL: "https://example.com/doc", UserID: userID}
+	if err = data.SetPassword("secret"); err != nil {
+		panic(err)
+	}
+	if err = storage.Stor.Post(context.Background(), data); err != nil {
+		panic(err)
+	}
+	router := chi.NewRouter()
+	router.Use(asUser(userID))
+	router.Get("/{shortURL}", GetHandler)
+	router.Post("/{shortURL}", PasswordHandler)
+	router.Get("/api/user/urls/{shortURL}", GetUserURLByShortHandler)
+	router.Patch("/api/user/urls/{shortURL}", PatchUserURLHandler)
+
+	var access *http.Cookie
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		remoteAddr   string
+		withCookie   bool
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{"form", http.MethodGet, "/" + data.ShortURL, "", "", false, http.StatusOK, "", "<form"},
+		{"wrong password", http.MethodPost, "/" + data.ShortURL, "wrong", "", false, http.StatusUnauthorized, "", "Неверный пароль"},
+		{"right password", http.MethodPost, "/" + data.ShortURL, "secret", "", false, http.StatusSeeOther, "/" + data.ShortURL, ""},
+		{"redirect with access", http.MethodGet, "/" + data.ShortURL, "", "", true, http.StatusTemporaryRedirect, "https://example.com/doc", ""},
+		{"third attempt", http.MethodPost, "/" + data.ShortURL, "wrong", "", false, http.StatusUnauthorized, "", ""},
+		{"attempts exhausted", http.MethodPost, "/" + data.ShortURL, "secret", "", false, http.StatusTooManyRequests, "", "Слишком много попыток"},
+		{"other client", http.MethodPost, "/" + data.ShortURL, "secret", "203.0.113.7:1000", false, http.StatusSeeOther, "/" + data.ShortURL, ""},
+		{"owner sees protection", http.MethodGet, "/api/user/urls/" + data.ShortURL, "", "", false, http.StatusOK, "", `"protected":true`},
+		{"bad new password", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"password":"abc"}`, "", false, http.StatusBadRequest, "", ""},
+		{"change password", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"password":"new secret"}`, "", false, http.StatusOK, "", ""},
+		{"access revoked", http.MethodGet, "/" + data.ShortURL, "", "", true, http.StatusOK, "", "<form"},
+		{"remove password", http.MethodPatch, "/api/user/urls/" + data.ShortURL, `{"password":""}`, "", false, http.StatusOK, "", ""},
+		{"open link", http.MethodGet, "/" + data.ShortURL, "", "", false, http.StatusTemporaryRedirect, "https://example.com/doc", ""},
+		{"form for open link", http.MethodPost, "/" + data.ShortURL, "secret", "203.0.113.8:1000", false, http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := tt.body
+			if tt.method == http.MethodPost {
+				body = url.Values{"password": {tt.body}}.Encode()
+			}
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+			if tt.method == http.MethodPost {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+			if tt.withCookie && access != nil {
+				r.AddCookie(access)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			if err != nil {
+				panic(err)
+			}
+
+			if !assert.Equal(t, tt.wantStatus, resp.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v\nbody %s", tt.wantStatus, resp.StatusCode, b))
+			}
+			assert.Equal(t, tt.wantLocation, resp.Header.Get("Location"))
+			assert.Contains(t, string(b), tt.wantBody)
+			assert.NotContains(t, string(b), "password_hash")
+			if resp.StatusCode == http.StatusSeeOther {
+				cookies := resp.Cookies()
+				if assert.Len(t, cookies, 1) {
+					access = cookies[0]
+				}
+			}
+			if tt.wantLocation == "https://example.com/doc" && tt.withCookie {
+				assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+			}
+		})
+	}
+}
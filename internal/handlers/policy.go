@@ -0,0 +1,50 @@
+// Package handlers реализует ответы на нарушение политики адресов назначения
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gerasimovpavel/shortener.git/internal/policy"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"net/http"
+)
+
+// PolicyError Ответ на нарушение политики
+type PolicyError struct {
+	Error         string `json:"error"`
+	Reason        string `json:"reason"`
+	Rule          string `json:"rule"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// checkPolicy Проверка адреса назначения и цепочки коротких ссылок перед сохранением.
+// shortURL - короткая ссылка, которой принадлежит адрес, пусто при создании.
+// При нарушении пишет ответ 422 с причиной и возвращает false
+func checkPolicy(w http.ResponseWriter, r *http.Request, shortURL, originalURL, corrID string) bool {
+	err := policy.Current().Check(r.Context(), originalURL)
+	if err == nil {
+		err = policy.CheckChain(r.Context(), storage.Stor, shortURL, originalURL)
+	}
+	if err == nil {
+		return true
+	}
+	var violation *policy.Violation
+	if !errors.As(err, &violation) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	writePolicyError(w, violation, corrID, http.StatusUnprocessableEntity)
+	return false
+}
+
+// writePolicyError Ответ с причиной нарушения политики
+func writePolicyError(w http.ResponseWriter, v *policy.Violation, corrID string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(PolicyError{
+		Error:         "policy_violation",
+		Reason:        v.Reason,
+		Rule:          v.Rule,
+		CorrelationID: corrID,
+	})
+}
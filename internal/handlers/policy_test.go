@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/policy"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Policy(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	config.Options.PolicyDenyFile = filepath.Join(t.TempDir(), "deny")
+	if err = os.WriteFile(config.Options.PolicyDenyFile, []byte("evil.com\n"), 0600); err != nil {
+		panic(err)
+	}
+	config.Options.PolicyDenyCIDRs = []string{"127.0.0.0/8"}
+	defer func() {
+		config.Options.PolicyDenyFile = ""
+		config.Options.PolicyDenyCIDRs = nil
+		policy.Set(nil)
+	}()
+	p, err := policy.Load()
+	if err != nil {
+		panic(err)
+	}
+	policy.Set(p)
+
+	tests := []struct {
+		name       string
+		hfunc      http.HandlerFunc
+		body       string
+		wantStatus int
+		wantReason string
+	}{
+		{"denied domain", PostHandler, "https://login.evil.com/", http.StatusUnprocessableEntity, policy.ReasonDomainDenied},
+		{"private address", PostJSONHandler, `{"url":"http://127.0.0.1:8080/"}`, http.StatusUnprocessableEntity, policy.ReasonPrivateAddress},
+		{"batch", PostJSONBatchHandler, `[{"correlation_id":"1","original_url":"https://evil.com/"}]`, http.StatusUnprocessableEntity, policy.ReasonDomainDenied},
+		{"allowed", PostHandler, "https://example.com/", http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			tt.hfunc(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if !assert.Equal(t, tt.wantStatus, resp.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, resp.StatusCode))
+			}
+			if tt.wantReason == "" {
+				return
+			}
+			var pe PolicyError
+			if err := json.NewDecoder(resp.Body).Decode(&pe); err != nil {
+				panic(err)
+			}
+			assert.Equal(t, "policy_violation", pe.Error)
+			assert.Equal(t, tt.wantReason, pe.Reason)
+		})
+	}
+
+	// сохраненная ссылка блокируется при переходе после обновления списка
+	data := &storage.URLData{OriginalURL: "https://phish.example.org/"}
+	if err = storage.Stor.Post(context.Background(), data); err != nil {
+		panic(err)
+	}
+	if err = os.WriteFile(config.Options.PolicyDenyFile, []byte("example.org\n"), 0600); err != nil {
+		panic(err)
+	}
+	p, err = policy.Load()
+	if err != nil {
+		panic(err)
+	}
+	policy.Set(p)
+	w := httptest.NewRecorder()
+	GetHandler(w, httptest.NewRequest(http.MethodGet, "/"+data.ShortURL, nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// ссылки, указывающие друг на друга, не редиректят по кругу.
+	// Списки сбрасываются: localhost попадает в запрещенную подсеть loopback
+	policy.Set(nil)
+	config.Options.ShortURLHost = "http://localhost:8080"
+	config.Options.RedirectMaxDepth = 5
+	defer func() {
+		config.Options.ShortURLHost = ""
+		config.Options.RedirectMaxDepth = 0
+	}()
+	for short, target := range map[string]string{"loop1": "http://localhost:8080/loop2", "loop2": "http://localhost:8080/loop1"} {
+		if err = storage.Stor.Post(context.Background(), &storage.URLData{ShortURL: short, OriginalURL: target}); err != nil {
+			panic(err)
+		}
+	}
+	w = httptest.NewRecorder()
+	GetHandler(w, httptest.NewRequest(http.MethodGet, "/loop1", nil))
+	assert.Equal(t, http.StatusLoopDetected, w.Code)
+
+	// сквозная ссылка на собственный путь не наращивает путь бесконечно
+	self := &storage.URLData{ShortURL: "self", OriginalURL: "http://localhost:8080/self/", Passthrough: true}
+	if err = storage.Stor.Post(context.Background(), self); err != nil {
+		panic(err)
+	}
+	w = httptest.NewRecorder()
+	GetHandler(w, httptest.NewRequest(http.MethodGet, "/self/x", nil))
+	assert.Equal(t, http.StatusLoopDetected, w.Code)
+}
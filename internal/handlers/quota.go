@@ -0,0 +1,42 @@
+// Package handlers реализует просмотр квоты ссылок пользователя
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/middleware"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"io"
+	"net/http"
+)
+
+// QuotaResponse Использование квоты ссылок. Limit 0 - без ограничения
+type QuotaResponse struct {
+	Used      int  `json:"used"`
+	Limit     int  `json:"limit"`
+	Remaining *int `json:"remaining,omitempty"`
+}
+
+// QuotaHandler Хендлер для получения использования квоты пользователя
+func QuotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserIDFromContext(r.Context())
+	used, err := storage.Stor.CountUserURL(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("ошибка чтения: %v", err), http.StatusInternalServerError)
+		return
+	}
+	resp := QuotaResponse{Used: used, Limit: storage.QuotaFor(userID)}
+	if resp.Limit > 0 {
+		remaining := max(resp.Limit-used, 0)
+		resp.Remaining = &remaining
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nНе могу сериализовать в json", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(body))
+}
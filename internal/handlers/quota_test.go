@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/middleware"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_Quota(t *testing.T) {
+	var err error
+	storage.Stor, err = storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	config.Options.UserQuota = 2
+	defer func() { config.Options.UserQuota = 0 }()
+
+	tests := []struct {
+		name       string
+		hfunc      http.HandlerFunc
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"quota empty", QuotaHandler, "", http.StatusOK, `{"used":0,"limit":2,"remaining":2}`},
+		{"post", PostHandler, "https://example.com/1", http.StatusCreated, ""},
+		{"batch over quota", PostJSONBatchHandler,
+			`[{"correlation_id":"a","original_url":"https://example.com/2"},{"correlation_id":"b","original_url":"https://example.com/3"}]`,
+			http.StatusCreated, ""},
+		{"quota used", QuotaHandler, "", http.StatusOK, `{"used":2,"limit":2,"remaining":0}`},
+		{"post over quota", PostJSONHandler, `{"url":"https://example.com/4"}`, http.StatusForbidden, ""},
+		{"batch all over quota", PostJSONBatchHandler, `[{"correlation_id":"c","original_url":"https://example.com/5"}]`, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r = r.WithContext(middleware.WithUserID(r.Context(), "quota-user"))
+			w := httptest.NewRecorder()
+			tt.hfunc(w, r)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if !assert.Equal(t, tt.wantStatus, resp.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, resp.StatusCode))
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				panic(err)
+			}
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, string(body))
+			}
+			if tt.name != "batch over quota" {
+				return
+			}
+			// второй элемент пакета отклонен квотой
+			var items []*storage.URLData
+			if err = json.Unmarshal(body, &items); err != nil {
+				panic(err)
+			}
+			assert.Empty(t, items[0].Error)
+			assert.NotEmpty(t, items[0].ShortURL)
+			assert.Equal(t, storage.ErrQuotaExceeded.Error(), items[1].Error)
+			assert.Empty(t, items[1].ShortURL)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Package handlers реализует ответы вне окна активности ссылки
+package handlers
+
+import (
+	"errors"
+	"github.com/gerasimovpavel/shortener.git/internal/policy"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// comingSoon Страница еще не активированной ссылки. В шаблон передается comingSoonData
+var comingSoon = template.Must(template.New("coming-soon").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Ссылка скоро заработает</title>
+</head>
+<body>
+<p>Ссылка заработает {{.NotBefore.Format "02.01.2006 15:04 MST"}}</p>
+</body>
+</html>
+`))
+
+// comingSoonData Данные шаблона страницы еще не активированной ссылки
+type comingSoonData struct {
+	ShortURL  string
+	NotBefore time.Time
+}
+
+// LoadComingSoon Загрузка шаблона страницы еще не активированной ссылки из файла
+func LoadComingSoon(filename string) error {
+	t, err := template.ParseFiles(filename)
+	if err != nil {
+		return err
+	}
+	comingSoon = t
+	return nil
+}
+
+// writeOutsideWindow Ответ на переход вне окна активности ссылки: перенаправление на запасной адрес,
+// до активации без него - страница ожидания, после окончания - запасной адрес сервера или 410
+func writeOutsideWindow(w http.ResponseWriter, r *http.Request, data *storage.URLData, phase storage.Phase) {
+	// ответ меняется с началом и концом окна, поэтому не кэшируется
+	w.Header().Set("Cache-Control", "no-store")
+	fallback := data.Fallback(phase)
+	if fallback == "" && phase == storage.PhasePending {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		comingSoon.Execute(w, comingSoonData{ShortURL: data.ShortURL, NotBefore: *data.NotBefore})
+		return
+	}
+	if fallback == "" {
+		http.Error(w, "срок действия ссылки истек", http.StatusGone)
+		return
+	}
+	var violation *policy.Violation
+	if errors.As(policy.Current().CheckStored(r.Context(), fallback), &violation) {
+		writePolicyError(w, violation, "", http.StatusForbidden)
+		return
+	}
+	http.Redirect(w, r, fallback, http.StatusTemporaryRedirect)
+}
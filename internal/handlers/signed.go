@@ -0,0 +1,139 @@
+// Package handlers реализует подписанные ссылки с ограниченным сроком действия
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signatureParams Параметры подписи в адресе перехода: срок действия в секундах Unix и подпись
+var signatureParams = []string{"exp", "sig"}
+
+// SignRequest Запрос на подпись ссылки. Без срока подпись действует config.Options.SignedURLTTL
+type SignRequest struct {
+	// Срок действия подписи, например "2h"
+	TTL string `json:"ttl,omitempty"`
+	// Момент окончания действия подписи, вместо TTL
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// SignResponse Подписанная ссылка и окончание ее действия
+type SignResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// expires Окончание действия подписи по запросу
+func (sr *SignRequest) expires(now time.Time) (time.Time, error) {
+	if sr.TTL != "" && sr.ExpiresAt != nil {
+		return time.Time{}, errors.New("укажите ttl или expires_at")
+	}
+	exp := now.Add(config.Options.SignedURLTTL)
+	if sr.ExpiresAt != nil {
+		exp = *sr.ExpiresAt
+	}
+	if sr.TTL != "" {
+		ttl, err := time.ParseDuration(sr.TTL)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("неверный ttl: %w", err)
+		}
+		exp = now.Add(ttl)
+	}
+	// подпись хранит срок с точностью до секунды
+	exp = exp.Truncate(time.Second)
+	if !exp.After(now) {
+		return time.Time{}, errors.New("срок действия подписи должен быть в будущем")
+	}
+	if config.Options.SignedURLMaxTTL > 0 && exp.Sub(now) > config.Options.SignedURLMaxTTL {
+		return time.Time{}, fmt.Errorf("срок действия подписи больше %v", config.Options.SignedURLMaxTTL)
+	}
+	return exp, nil
+}
+
+// SignUserURLHandler Хендлер для подписи ссылки пользователя, переход по которой требует подписи
+func SignUserURLHandler(w http.ResponseWriter, r *http.Request) {
+	data := userURL(w, r)
+	if data == nil {
+		return
+	}
+	if !data.RequireSignature {
+		http.Error(w, "ссылка не требует подписи", http.StatusBadRequest)
+		return
+	}
+
+	sr := new(SignRequest)
+	err := json.NewDecoder(r.Body).Decode(sr)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("%s\n\nне могу десериализовать тело запроса", err.Error()), http.StatusBadRequest)
+		return
+	}
+	exp, err := sr.expires(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sig, err := crypt.SignURL(data.ShortURL, exp)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("не могу подписать ссылку: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	query := url.Values{"exp": {strconv.FormatInt(exp.Unix(), 10)}, "sig": {sig}}
+	body, err := json.Marshal(SignResponse{
+		URL:       fmt.Sprintf(`%s/%s?%s`, config.Options.ShortURLHost, data.ShortURL, query.Encode()),
+		ExpiresAt: exp.UTC(),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s\n\nНе могу сериализовать в json", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(body))
+}
+
+// checkSignature Проверка подписи перехода по ссылке.
+// Без подписи или с неверной подписью - 403, с истекшей - 410. При ошибке пишет ответ и возвращает false
+func checkSignature(w http.ResponseWriter, r *http.Request, data *storage.URLData) bool {
+	w.Header().Set("Cache-Control", "no-store")
+	query := r.URL.Query()
+	err := crypt.VerifyURL(data.ShortURL, query.Get("exp"), query.Get("sig"))
+	if errors.Is(err, crypt.ErrSignatureExpired) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return false
+	}
+	if err != nil {
+		http.Error(w, crypt.ErrSignatureInvalid.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// stripParams Строка запроса rawQuery без параметров names. Порядок и запись остальных параметров сохраняются
+func stripParams(rawQuery string, names ...string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	parts := strings.Split(rawQuery, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		name, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(name); err == nil && slices.Contains(names, name) {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	return strings.Join(kept, "&")
+}
@@ -0,0 +1,32 @@
+// Package handlers реализует закрепление вариантов A/B теста за посетителем
+package handlers
+
+import (
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"net/http"
+)
+
+// variantCookiePrefix Префикс имени куки с вариантом ссылки
+const variantCookiePrefix = "ab_"
+
+// variantCookie Вариант ссылки shortURL, закрепленный за посетителем
+func variantCookie(r *http.Request, shortURL string) string {
+	cookie, err := r.Cookie(variantCookiePrefix + shortURL)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// setVariantCookie Закрепление варианта ссылки за посетителем
+func setVariantCookie(w http.ResponseWriter, shortURL, variant string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookiePrefix + shortURL,
+		Value:    variant,
+		Path:     "/" + shortURL,
+		MaxAge:   int(config.Options.VariantCookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   config.Options.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,178 @@
+// Package metrics реализует сбор метрик сервиса в формате Prometheus
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const namespace = "shortener"
+
+// Registry Реестр метрик сервиса
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests Количество http запросов по маршруту и статусу
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Количество обработанных http запросов",
+	}, []string{"route", "method", "status"})
+
+	// HTTPDuration Время обработки http запросов
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Время обработки http запросов",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// StorageDuration Время выполнения операций хранилища
+	StorageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Время выполнения операций хранилища",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"backend", "method"})
+
+	// StorageErrors Количество ошибок хранилища
+	StorageErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "errors_total",
+		Help:      "Количество ошибок операций хранилища",
+	}, []string{"backend", "method"})
+
+	// DeleteQueueDepth Количество пакетов ссылок, ожидающих удаления
+	DeleteQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "deleter",
+		Name:      "queue_depth",
+		Help:      "Количество пакетов ссылок, ожидающих удаления",
+	})
+
+	// RateLimited Количество запросов, отклоненных ограничением частоты
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Количество запросов, отклоненных ограничением частоты",
+	}, []string{"group"})
+
+	// PolicyRejected Количество ссылок, отклоненных политикой адресов назначения
+	PolicyRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "policy",
+		Name:      "rejected_total",
+		Help:      "Количество ссылок, отклоненных политикой адресов назначения",
+	}, []string{"reason"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		StorageDuration,
+		StorageErrors,
+		DeleteQueueDepth,
+		RateLimited,
+		PolicyRejected,
+		pgPool,
+	)
+}
+
+// Handler Хендлер для выдачи метрик
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveHTTP Учет обработанного http запроса
+func ObserveHTTP(route, method string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unknown"
+	}
+	HTTPRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	HTTPDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+// ObserveStorage Учет выполненной операции хранилища
+func ObserveStorage(backend, method string, start time.Time, err error) {
+	StorageDuration.WithLabelValues(backend, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		StorageErrors.WithLabelValues(backend, method).Inc()
+	}
+}
+
+// pgPoolCollector Сборщик статистики пула соединений postgres
+type pgPoolCollector struct {
+	mu   sync.RWMutex
+	stat func() *pgxpool.Stat
+
+	acquired     *prometheus.Desc
+	idle         *prometheus.Desc
+	total        *prometheus.Desc
+	max          *prometheus.Desc
+	acquireCount *prometheus.Desc
+	acquireWait  *prometheus.Desc
+}
+
+var pgPool = newPgPoolCollector()
+
+func newPgPoolCollector() *pgPoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pgxpool", name), help, nil, nil)
+	}
+	return &pgPoolCollector{
+		acquired:     desc("acquired_conns", "Количество занятых соединений"),
+		idle:         desc("idle_conns", "Количество свободных соединений"),
+		total:        desc("total_conns", "Общее количество соединений"),
+		max:          desc("max_conns", "Максимальное количество соединений"),
+		acquireCount: desc("acquire_total", "Количество получений соединения из пула"),
+		acquireWait:  desc("acquire_duration_seconds_total", "Суммарное время ожидания соединения"),
+	}
+}
+
+// SetPgPoolStat Установка источника статистики пула соединений postgres
+func SetPgPoolStat(stat func() *pgxpool.Stat) {
+	pgPool.mu.Lock()
+	defer pgPool.mu.Unlock()
+	pgPool.stat = stat
+}
+
+// Describe Описание метрик пула
+func (c *pgPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.total
+	ch <- c.max
+	ch <- c.acquireCount
+	ch <- c.acquireWait
+}
+
+// Collect Сбор метрик пула
+func (c *pgPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	statFunc := c.stat
+	c.mu.RUnlock()
+	if statFunc == nil {
+		return
+	}
+	stat := statFunc()
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireWait, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
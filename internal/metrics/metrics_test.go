@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Metrics(t *testing.T) {
+	ObserveHTTP("/{shortURL}", http.MethodGet, http.StatusTemporaryRedirect, time.Millisecond)
+	ObserveStorage("memory", "Get", time.Now(), nil)
+	ObserveStorage("memory", "Post", time.Now(), errors.New("storage error"))
+	DeleteQueueDepth.Inc()
+	defer DeleteQueueDepth.Dec()
+
+	tests := []struct {
+		name   string
+		metric string
+	}{
+		{"http requests", `shortener_http_requests_total{method="GET",route="/{shortURL}",status="307"} 1`},
+		{"http duration", `shortener_http_request_duration_seconds_count{method="GET",route="/{shortURL}"} 1`},
+		{"storage duration", `shortener_storage_operation_duration_seconds_count{backend="memory",method="Get"} 1`},
+		{"storage errors", `shortener_storage_errors_total{backend="memory",method="Post"} 1`},
+		{"delete queue", `shortener_deleter_queue_depth 1`},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !assert.Contains(t, string(b), tt.metric) {
+				panic(fmt.Errorf("metric %s not found", tt.metric))
+			}
+		})
+	}
+}
@@ -2,21 +2,151 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"github.com/gerasimovpavel/shortener.git/internal/users"
 	"github.com/gerasimovpavel/shortener.git/pkg/cookies"
 	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
 	"net/http"
+	"strings"
 )
 
-// UserID ID пользователя
-var UserID string
+// APIKeyHeader Заголовок с API-ключом
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyCtxKey Ключ контекста для API-ключа запроса
+type apiKeyCtxKey struct{}
+
+// userIDCtxKey Ключ контекста для ID пользователя запроса
+type userIDCtxKey struct{}
+
+// authenticatedCtxKey Ключ контекста для признака авторизации API-ключом или зарегистрированным пользователем
+type authenticatedCtxKey struct{}
+
+// Authenticated Запрос авторизован API-ключом или токеном зарегистрированного пользователя.
+// Токены анонимных пользователей выдаются автоматически, поэтому их ID не идентифицирует клиента
+func Authenticated(ctx context.Context) bool {
+	ok, _ := ctx.Value(authenticatedCtxKey{}).(bool)
+	return ok
+}
+
+// UserIDFromContext ID пользователя, авторизованного в запросе. Пустая строка - запрос без авторизации
+func UserIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(userIDCtxKey{}).(string)
+	return id
+}
+
+// WithUserID Контекст запроса с ID пользователя
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDCtxKey{}, userID)
+}
+
+// APIKeyFromContext API-ключ, которым авторизован запрос. nil - запрос авторизован токеном
+func APIKeyFromContext(ctx context.Context) *users.APIKey {
+	key, _ := ctx.Value(apiKeyCtxKey{}).(*users.APIKey)
+	return key
+}
+
+// apiKey API-ключ из заголовка X-API-Key или Authorization: Bearer
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && users.IsAPIKey(bearer) {
+		return bearer
+	}
+	return ""
+}
+
+// authAPIKey Авторизация по API-ключу. Неизвестный или отозванный ключ - 401
+func authAPIKey(w http.ResponseWriter, r *http.Request, plain string) (*http.Request, bool) {
+	key, err := users.Stor.GetAPIKey(r.Context(), users.HashAPIKey(plain))
+	if errors.Is(err, users.ErrAPIKeyNotFound) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return r, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return r, false
+	}
+	ctx := context.WithValue(r.Context(), apiKeyCtxKey{}, key)
+	ctx = context.WithValue(ctx, authenticatedCtxKey{}, true)
+	return r.WithContext(WithUserID(ctx, key.UserID)), true
+}
+
+// RequireScope Проверка области действия API-ключа. Запросы с токеном пропускаются
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := APIKeyFromContext(r.Context())
+			if key != nil && !key.HasScope(scope) {
+				http.Error(w, "API-ключ не разрешает "+scope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SessionOnly Запрет доступа по API-ключу
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if APIKeyFromContext(r.Context()) != nil {
+			http.Error(w, "доступ по API-ключу запрещен", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ErrTokenRevoked Токен отозван при выходе пользователя
+var ErrTokenRevoked = errors.New("токен отозван")
+
+// parseToken Получение ID пользователя из токена.
+// Истекший, отозванный или поврежденный токен - 401, иначе 500.
+// Токен, подписанный выведенным из оборота ключом или близкий к истечению, перевыпускается через Set-Cookie
+func parseToken(w http.ResponseWriter, r *http.Request, token string) (*http.Request, bool) {
+	claims, err := crypt.ParseToken(token)
+	if err == nil && claims.ID != "" {
+		var revoked bool
+		revoked, err = users.Stor.IsTokenRevoked(r.Context(), claims.ID)
+		if err == nil && revoked {
+			err = ErrTokenRevoked
+		}
+	}
+	if errors.Is(err, crypt.ErrTokenExpired) || errors.Is(err, crypt.ErrTokenInvalid) || errors.Is(err, ErrTokenRevoked) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return r, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return r, false
+	}
+	ctx := WithUserID(r.Context(), claims.UserID)
+	if claims.Registered {
+		ctx = context.WithValue(ctx, authenticatedCtxKey{}, true)
+	}
+	r = r.WithContext(ctx)
+	if claims.NeedsRefresh() {
+		cookie, err := cookies.ReissueCookie(nil, claims)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return r, false
+		}
+		http.SetCookie(w, cookie)
+		w.Header().Set("Authorization", cookie.Value)
+	}
+	return r, true
+}
 
 // AuthCookie Проверка авторизации пользователя по куки
 func AuthCookie(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		UserID = ""
-		cookie, _ := r.Cookie("UserID")
+		cookie, _ := r.Cookie(cookies.Name)
 		err := cookie.Valid()
-		if err != nil {
+		issued := err != nil
+		if issued {
 			cookie, err = cookies.NewCookie(cookie)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -27,36 +157,38 @@ func AuthCookie(next http.Handler) http.Handler {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
-		UserID, err = crypt.Decrypt(cookie.Value)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		r, ok := parseToken(w, r, cookie.Value)
+		if !ok {
 			return
 		}
-		if cookie.Value == "" {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		// куки из запроса не возвращаем: это затерло бы перевыпущенную parseToken
+		if issued {
+			http.SetCookie(w, cookie)
 		}
-		http.SetCookie(w, cookie)
 		next.ServeHTTP(w, r)
 	})
 }
 
-// AuthHeader Проверка авторизации пользователя по Header
+// AuthHeader Проверка авторизации пользователя по Header или API-ключу
 func AuthHeader(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var err error
-		UserID = ""
+		if plain := apiKey(r); plain != "" {
+			r, ok := authAPIKey(w, r, plain)
+			if ok {
+				next.ServeHTTP(w, r)
+			}
+			return
+		}
 
-		header := r.Header.Get("Authorization")
+		header := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 
 		if header == "" {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
-		UserID, err = crypt.Decrypt(header)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		r, ok := parseToken(w, r, header)
+		if !ok {
 			return
 		}
 
@@ -64,16 +196,22 @@ func AuthHeader(next http.Handler) http.Handler {
 	})
 }
 
-// AutoAuthHeader Проверка авторизации пользователя по Header с автоматической авторизацией
+// AutoAuthHeader Проверка авторизации пользователя по Header или API-ключу с автоматической авторизацией
 func AutoAuthHeader(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var err error
-		UserID = ""
+		if plain := apiKey(r); plain != "" {
+			r, ok := authAPIKey(w, r, plain)
+			if ok {
+				next.ServeHTTP(w, r)
+			}
+			return
+		}
 
-		header := r.Header.Get("Authorization")
+		header := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 
 		if header == "" {
-			cookie, _ := r.Cookie("UserID")
+			cookie, _ := r.Cookie(cookies.Name)
 			err = cookie.Valid()
 			if err != nil {
 				cookie, err = cookies.NewCookie(cookie)
@@ -92,9 +230,8 @@ func AutoAuthHeader(next http.Handler) http.Handler {
 			return
 		}
 
-		UserID, err = crypt.Decrypt(header)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		r, ok := parseToken(w, r, header)
+		if !ok {
 			return
 		}
 
@@ -1,13 +1,27 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/users"
+	"github.com/gerasimovpavel/shortener.git/pkg/cookies"
+	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func Test_Auth(t *testing.T) {
+	var err error
+	users.Stor, err = users.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 
 	w := httptest.NewRecorder()
@@ -24,10 +38,190 @@ func Test_Auth(t *testing.T) {
 			break
 		}
 	}
-	err := cookie.Valid()
+	err = cookie.Valid()
 
 	if err != nil {
 		panic(fmt.Errorf("cookie error: %w", err))
 	}
 
 }
+
+func Test_AuthHeaderExpired(t *testing.T) {
+	config.Options.PassphraseKey = "auth test key"
+	var err error
+	users.Stor, err = users.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	claims := &crypt.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-2 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+		},
+		UserID: "53be0840-8503-11ee-b9d1-0242ac120002",
+	}
+	key := sha256.Sum256([]byte(config.Options.PassphraseKey))
+	var expired string
+	expired, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key[:])
+	if err != nil {
+		panic(err)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{"expired token", expired, http.StatusUnauthorized},
+		{"garbage token", "not a token", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, h := range []http.Handler{
+				AuthHeader(http.HandlerFunc(EmptyHandlerFunc)),
+				AutoAuthHeader(http.HandlerFunc(EmptyHandlerFunc)),
+			} {
+				req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+				req.Header.Set("Authorization", tt.header)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				res := w.Result()
+				res.Body.Close()
+				if !assert.Equal(t, tt.wantStatus, res.StatusCode) {
+					panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, res.StatusCode))
+				}
+			}
+		})
+	}
+}
+
+func Test_AuthAPIKey(t *testing.T) {
+	var err error
+	users.Stor, err = users.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	ctx := context.Background()
+	readKey, key, err := users.NewAPIKey("ci-user", "ci", []string{users.ScopeRead})
+	if err != nil {
+		panic(err)
+	}
+	assert.NoError(t, users.Stor.CreateAPIKey(ctx, key))
+	revokedKey, revoked, err := users.NewAPIKey("ci-user", "old", []string{users.ScopeRead, users.ScopeShorten})
+	if err != nil {
+		panic(err)
+	}
+	assert.NoError(t, users.Stor.CreateAPIKey(ctx, revoked))
+	assert.NoError(t, users.Stor.RevokeAPIKey(ctx, "ci-user", revoked.ID))
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		scope      string
+		wantStatus int
+	}{
+		{"X-API-Key with scope", APIKeyHeader, readKey, users.ScopeRead, http.StatusOK},
+		{"bearer with scope", "Authorization", "Bearer " + readKey, users.ScopeRead, http.StatusOK},
+		{"missing scope", APIKeyHeader, readKey, users.ScopeShorten, http.StatusForbidden},
+		{"revoked key", APIKeyHeader, revokedKey, users.ScopeRead, http.StatusUnauthorized},
+		{"unknown key", "Authorization", "Bearer " + users.APIKeyPrefix + "unknown", users.ScopeRead, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, auth := range []func(http.Handler) http.Handler{AuthHeader, AutoAuthHeader} {
+				var userID string
+				h := auth(RequireScope(tt.scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					userID = UserIDFromContext(r.Context())
+					EmptyHandlerFunc(w, r)
+				})))
+				req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+				req.Header.Set(tt.header, tt.value)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				res := w.Result()
+				res.Body.Close()
+				if !assert.Equal(t, tt.wantStatus, res.StatusCode) {
+					panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, res.StatusCode))
+				}
+				if tt.wantStatus == http.StatusOK {
+					assert.Equal(t, "ci-user", userID)
+				}
+			}
+		})
+	}
+}
+
+func Test_AuthRevokeAndRefresh(t *testing.T) {
+	config.Options.PassphraseKey = "auth test key"
+	config.Options.TokenTTL = time.Hour
+	defer func() { config.Options.TokenRefreshBefore = 0 }()
+	var err error
+	users.Stor, err = users.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	revoked, claims, err := crypt.BuildToken("53be0840-8503-11ee-b9d1-0242ac120002")
+	if err != nil {
+		panic(err)
+	}
+	assert.NoError(t, users.Stor.RevokeToken(context.Background(), claims.ID, claims.ExpiresAt.Time))
+	valid, _, err := crypt.BuildToken("53be0840-8503-11ee-b9d1-0242ac120002")
+	if err != nil {
+		panic(err)
+	}
+	// токен прежнего формата (AES-GCM) того же пользователя, выпущенный с "auth test key"
+	legacy := "eb87c5cbbd676a138951252bac48c179b2231b3d31eda9d4e677bb87452ee74ba319080d8a841509b6f6769c40ce2c6386fd12da"
+
+	tests := []struct {
+		name          string
+		token         string
+		refreshBefore time.Duration
+		wantStatus    int
+		wantRefresh   bool
+	}{
+		{"revoked token", revoked, 0, http.StatusUnauthorized, false},
+		{"fresh token", valid, 10 * time.Minute, http.StatusOK, false},
+		{"token close to expiry", valid, 2 * time.Hour, http.StatusOK, true},
+		{"legacy token", legacy, 0, http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Options.TokenRefreshBefore = tt.refreshBefore
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			req.Header.Set("Authorization", tt.token)
+			w := httptest.NewRecorder()
+			AuthHeader(http.HandlerFunc(EmptyHandlerFunc)).ServeHTTP(w, req)
+			res := w.Result()
+			res.Body.Close()
+			if !assert.Equal(t, tt.wantStatus, res.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, res.StatusCode))
+			}
+			assert.Equal(t, tt.wantRefresh, len(res.Cookies()) > 0)
+			if tt.wantRefresh {
+				assert.NotEqual(t, tt.token, res.Header.Get("Authorization"))
+				// перевыпущенный токен - JWT того же пользователя
+				refreshed, err := crypt.ParseToken(res.Header.Get("Authorization"))
+				if assert.NoError(t, err) {
+					assert.Equal(t, "53be0840-8503-11ee-b9d1-0242ac120002", refreshed.UserID)
+					assert.False(t, refreshed.Legacy)
+				}
+			}
+
+			// по куки перевыпущенный токен не затирается токеном из запроса
+			req = httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			req.AddCookie(&http.Cookie{Name: cookies.Name, Value: tt.token})
+			w = httptest.NewRecorder()
+			AuthCookie(http.HandlerFunc(EmptyHandlerFunc)).ServeHTTP(w, req)
+			res = w.Result()
+			res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantRefresh && assert.Len(t, res.Cookies(), 1) {
+				assert.NotEqual(t, tt.token, res.Cookies()[0].Value)
+			}
+			if !tt.wantRefresh {
+				assert.Empty(t, res.Cookies())
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Package middleware реализует определение IP адреса клиента за доверенными прокси
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies Подсети доверенных прокси, от которых принимается X-Forwarded-For
+var TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies Разбор подсетей доверенных прокси. Отдельный адрес считается подсетью из одного адреса
+func ParseTrustedProxies(items []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, item := range items {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("доверенный прокси %q: неверный адрес", item)
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("доверенный прокси %q: %w", item, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// trustedProxy Входит ли адрес в подсети доверенных прокси
+func trustedProxy(ip net.IP) bool {
+	for _, n := range TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP IP адрес клиента. Если запрос пришел от доверенного прокси, X-Forwarded-For
+// просматривается справа налево до первого адреса не из доверенных подсетей.
+// Левые адреса цепочки подставляет сам клиент, поэтому им не доверяем
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trustedProxy(ip) {
+		return host
+	}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		host = hop.String()
+		if !trustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_ClientIP(t *testing.T) {
+	var err error
+	TrustedProxies, err = ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		panic(err)
+	}
+	defer func() { TrustedProxies = nil }()
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{"direct client", "203.0.113.5:1000", nil, "203.0.113.5"},
+		{"spoofed header from untrusted", "203.0.113.5:1000", []string{"2.125.160.216"}, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:1000", []string{"2.125.160.216"}, "2.125.160.216"},
+		{"chain of trusted proxies", "10.0.0.1:1000", []string{"2.125.160.216, 192.168.1.1"}, "2.125.160.216"},
+		{"spoofed left part", "10.0.0.1:1000", []string{"1.1.1.1, 81.2.69.142"}, "81.2.69.142"},
+		{"several headers", "10.0.0.1:1000", []string{"1.1.1.1", "81.2.69.142, 10.0.0.2"}, "81.2.69.142"},
+		{"trusted proxy without header", "10.0.0.1:1000", nil, "10.0.0.1"},
+		{"garbage in header", "10.0.0.1:1000", []string{"unknown"}, "10.0.0.1"},
+		{"only trusted in header", "10.0.0.1:1000", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(r); !assert.Equal(t, tt.want, got) {
+				panic(fmt.Errorf("ip expect %v actual %v", tt.want, got))
+			}
+		})
+	}
+}
+
+func Test_ParseTrustedProxies(t *testing.T) {
+	nets, err := ParseTrustedProxies([]string{"10.0.0.0/8", "::1", "127.0.0.1"})
+	assert.NoError(t, err)
+	assert.Len(t, nets, 3)
+	_, err = ParseTrustedProxies([]string{"proxy.local"})
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
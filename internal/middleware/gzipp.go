@@ -2,6 +2,7 @@
 package middleware
 
 import (
+	"github.com/gerasimovpavel/shortener.git/internal/tracing"
 	"github.com/gerasimovpavel/shortener.git/pkg/compressor"
 	"net/http"
 	"strings"
@@ -10,6 +11,9 @@ import (
 // Gzip Сжатие данных
 func Gzip(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Tracer().Start(r.Context(), "middleware.Gzip")
+		defer span.End()
+		r = r.WithContext(ctx)
 
 		nw := w
 
@@ -21,7 +25,12 @@ func Gzip(next http.Handler) http.Handler {
 
 			nw = cw
 
-			defer cw.Close()
+			defer func() {
+				// досылка буфера gzip отдельным span
+				_, fspan := tracing.Tracer().Start(ctx, "gzip.Flush")
+				cw.Close()
+				fspan.End()
+			}()
 		}
 
 		contentEncoding := r.Header.Get("Content-Encoding")
@@ -30,6 +39,7 @@ func Gzip(next http.Handler) http.Handler {
 
 			cr, err := compressor.NewCompressReader(r.Body)
 			if err != nil {
+				span.RecordError(err)
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
@@ -1,14 +1,13 @@
 package middleware
 
 import (
+	"github.com/gerasimovpavel/shortener.git/internal/metrics"
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 	"net/http"
 	"time"
 )
 
-// Sugar Логгер от zap
-var Sugar zap.SugaredLogger
-
 type (
 	responseData struct {
 		body   []byte
@@ -23,6 +22,10 @@ type (
 
 // Write Записб данных
 func (r *loggingResponseWriter) Write(b []byte) (int, error) {
+	if r.responseData.status == 0 {
+		// WriteHeader не вызывался, net/http отдаст 200
+		r.responseData.status = http.StatusOK
+	}
 	size, err := r.ResponseWriter.Write(b)
 	r.responseData.size += size
 	return size, err
@@ -34,7 +37,7 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode // захватываем код статуса
 }
 
-// Logger Запись запросов в лог
+// Logger Запись запросов в лог запросов l
 func Logger(l *zap.Logger) func(next http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -55,14 +58,25 @@ func Logger(l *zap.Logger) func(next http.Handler) http.Handler {
 			h.ServeHTTP(&lw, r)
 
 			duration := time.Since(start)
+			if responseData.status == 0 {
+				responseData.status = http.StatusOK
+			}
+
+			// учитываем запрос в метриках по шаблону маршрута chi
+			var route string
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+			metrics.ObserveHTTP(route, method, responseData.status, duration)
 
 			// отправляем сведения о запросе в zap
-			Sugar.Infoln(
-				"uri", uri,
-				"method", method,
-				"duration", duration,
-				"status", responseData.status,
-				"size", responseData.size,
+			l.Info("request",
+				zap.String("request_id", RequestIDFromContext(r.Context())),
+				zap.String("uri", uri),
+				zap.String("method", method),
+				zap.Duration("duration", duration),
+				zap.Int("status", responseData.status),
+				zap.Int("size", responseData.size),
 			)
 
 		})
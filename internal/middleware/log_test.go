@@ -18,7 +18,6 @@ func Test_Log(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	Sugar = *TestLogger.Sugar()
 
 	tests := []struct {
 		name       string
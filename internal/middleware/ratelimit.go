@@ -0,0 +1,47 @@
+// Package middleware реализует ограничение частоты запросов
+package middleware
+
+import (
+	"github.com/gerasimovpavel/shortener.git/internal/metrics"
+	"github.com/gerasimovpavel/shortener.git/internal/ratelimit"
+	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// RateLimit Ограничение частоты запросов группы маршрутов group.
+// Корзина выбирается по ID пользователя, авторизованного API-ключом или токеном зарегистрированного пользователя,
+// иначе по IP клиента с учетом доверенных прокси: анонимный токен выдается заново на каждый запрос без куки.
+// Для авторизованных маршрутов посредник ставится после авторизации.
+// Превышение - 429 с заголовком Retry-After. Ошибка хранилища ограничителя запрос не блокирует
+func RateLimit(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := ratelimit.Limits[group]
+			if ratelimit.Lim == nil || !limit.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := "ip:" + ClientIP(r)
+			if id := UserIDFromContext(r.Context()); id != "" && Authenticated(r.Context()) {
+				key = "user:" + id
+			}
+			ok, retry, err := ratelimit.Lim.Allow(r.Context(), group+":"+key, limit)
+			if err != nil {
+				logger.FromContext(r.Context()).Error("rate limiter failed", zap.String("group", group), zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !ok {
+				metrics.RateLimited.WithLabelValues(group).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(retry.Seconds())))))
+				http.Error(w, "слишком много запросов", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/ratelimit"
+	"github.com/gerasimovpavel/shortener.git/internal/users"
+	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_RateLimit(t *testing.T) {
+	ratelimit.Lim = ratelimit.NewMemLimiter()
+	ratelimit.Limits = map[string]ratelimit.Limit{"test": {Rate: 0.001, Burst: 2}}
+	defer func() {
+		ratelimit.Lim = nil
+		ratelimit.Limits = map[string]ratelimit.Limit{}
+	}()
+	h := RateLimit("test")(http.HandlerFunc(EmptyHandlerFunc))
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		userID        string
+		authenticated bool
+		wantStatus    int
+	}{
+		{"first request", "10.0.0.1:1000", "", false, http.StatusOK},
+		{"second request other port", "10.0.0.1:1001", "", false, http.StatusOK},
+		{"over limit", "10.0.0.1:1002", "", false, http.StatusTooManyRequests},
+		{"other ip", "10.0.0.2:1000", "", false, http.StatusOK},
+		{"anonymous user from limited ip", "10.0.0.1:1003", "anon-1", false, http.StatusTooManyRequests},
+		{"user from limited ip", "10.0.0.1:1003", "user-1", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.userID != "" {
+				req = req.WithContext(WithUserID(req.Context(), tt.userID))
+			}
+			if tt.authenticated {
+				req = req.WithContext(context.WithValue(req.Context(), authenticatedCtxKey{}, true))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			res := w.Result()
+			res.Body.Close()
+			if !assert.Equal(t, tt.wantStatus, res.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, res.StatusCode))
+			}
+			if tt.wantStatus == http.StatusTooManyRequests {
+				assert.NotEmpty(t, res.Header.Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func Test_RateLimitWithoutCookies(t *testing.T) {
+	config.Options.PassphraseKey = "rate limit test key"
+	config.Options.TokenTTL = time.Hour
+	var err error
+	users.Stor, err = users.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	ratelimit.Lim = ratelimit.NewMemLimiter()
+	ratelimit.Limits = map[string]ratelimit.Limit{"test": {Rate: 0.001, Burst: 2}}
+	defer func() {
+		ratelimit.Lim = nil
+		ratelimit.Limits = map[string]ratelimit.Limit{}
+	}()
+	h := AutoAuthHeader(RateLimit("test")(http.HandlerFunc(EmptyHandlerFunc)))
+	registered, _, err := crypt.BuildRegisteredToken("registered-user")
+	if err != nil {
+		panic(err)
+	}
+
+	// каждый запрос без куки получает новый анонимный токен, но лимит остается общим для IP
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"first request", "", http.StatusOK},
+		{"second request", "", http.StatusOK},
+		{"over limit", "", http.StatusTooManyRequests},
+		{"registered user from limited ip", registered, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.RemoteAddr = "10.0.0.1:1000"
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			res := w.Result()
+			res.Body.Close()
+			if !assert.Equal(t, tt.wantStatus, res.StatusCode) {
+				panic(fmt.Errorf("status expect %v actual %v", tt.wantStatus, res.StatusCode))
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package middleware /requestid реализует посредника для идентификации http запросов
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// RequestIDHeader Заголовок с идентификатором запроса
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen Максимальная длина идентификатора, принимаемого от клиента
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// RequestID Принимает идентификатор запроса из заголовка X-Request-ID или генерирует новый,
+// сохраняет его в контексте, возвращает в ответе и кладет в контекст логгер l
+// с этим идентификатором для всех записей лога запроса
+func RequestID(l *zap.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !ValidRequestID(id) {
+				id = NewRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			ctx := WithRequestID(r.Context(), id)
+			ctx = logger.WithContext(ctx, l.With(zap.String("request_id", id)))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// WithRequestID Сохранение идентификатора запроса в контексте
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext Идентификатор запроса из контекста
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID Генерация нового идентификатора запроса
+func NewRequestID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID Проверка идентификатора, пришедшего от клиента:
+// непустой, ограниченной длины и только из печатных ASCII символов
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
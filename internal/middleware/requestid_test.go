@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_RequestID(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	l := zap.New(core)
+
+	tests := []struct {
+		name     string
+		header   string
+		accepted bool
+	}{
+		{"accept client id", "client-request-42", true},
+		{"generate id", "", false},
+		{"reject invalid id", "bad id\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctxID string
+			h := RequestID(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID = RequestIDFromContext(r.Context())
+				logger.FromContext(r.Context()).Info("inside handler")
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			respID := res.Header.Get(RequestIDHeader)
+			if !assert.NotEmpty(t, respID) {
+				panic(fmt.Errorf("response has no %s header", RequestIDHeader))
+			}
+			assert.Equal(t, ctxID, respID)
+			if tt.accepted {
+				assert.Equal(t, tt.header, respID)
+			} else {
+				assert.NotEqual(t, tt.header, respID)
+			}
+
+			entries := logs.TakeAll()
+			if !assert.Len(t, entries, 1) {
+				panic(fmt.Errorf("log entries expect 1 actual %d", len(entries)))
+			}
+			assert.Equal(t, respID, entries[0].ContextMap()["request_id"])
+		})
+	}
+}
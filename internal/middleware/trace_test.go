@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Tracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	r := chi.NewRouter()
+	r.Use(Tracing)
+	r.Get("/{shortURL}", EmptyHandlerFunc)
+
+	req := httptest.NewRequest(http.MethodGet, "/abcdefg", nil)
+	req.Header.Set("traceparent", fmt.Sprintf("00-%s-00f067aa0ba902b7-01", traceID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	spans := sr.Ended()
+	if !assert.Len(t, spans, 1) {
+		panic(fmt.Errorf("spans expect 1 actual %d", len(spans)))
+	}
+	assert.Equal(t, "HTTP GET /{shortURL}", spans[0].Name())
+	assert.Equal(t, traceID, spans[0].SpanContext().TraceID().String())
+	assert.Contains(t, res.Header.Get("traceparent"), traceID)
+}
@@ -0,0 +1,103 @@
+// Package policy реализует защиту от цепочек и циклов коротких ссылок
+package policy
+
+import (
+	"context"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
+	"net/url"
+	"strings"
+)
+
+// Причины отклонения ссылок на собственный домен
+const (
+	ReasonSelfReference = "self_reference"
+	ReasonChainTooDeep  = "chain_too_deep"
+	ReasonRedirectLoop  = "redirect_loop"
+)
+
+// CheckChain Проверка цепочки коротких ссылок, начинающейся с адреса назначения originalURL.
+// Адреса на ShortURLHost разрешаются через хранилище, пока цепочка не уйдет на внешний адрес.
+// Путь после короткой ссылки продолжает цепочку, только если ссылка сквозная.
+// shortURL - короткая ссылка, которой принадлежит адрес, пусто при создании
+func CheckChain(ctx context.Context, stor storage.Storage, shortURL, originalURL string) error {
+	maxDepth := config.Options.RedirectMaxDepth
+	visited := map[string]bool{}
+	if shortURL != "" {
+		visited[shortURL] = true
+	}
+	for depth := 1; ; depth++ {
+		short, rest, query, ok := ownShortURL(originalURL)
+		if !ok {
+			return nil
+		}
+		var data *storage.URLData
+		var err error
+		if rest != "" {
+			// несквозная ссылка не открывается с продолжением пути
+			data, err = stor.Get(ctx, short)
+			if err != nil {
+				return err
+			}
+			if !data.Passthrough {
+				return nil
+			}
+		}
+		if maxDepth == 0 {
+			return reject(ReasonSelfReference, originalURL)
+		}
+		if visited[short] {
+			return reject(ReasonRedirectLoop, short)
+		}
+		if depth > maxDepth {
+			return reject(ReasonChainTooDeep, fmt.Sprintf("max depth %d", maxDepth))
+		}
+		visited[short] = true
+
+		if data == nil {
+			data, err = stor.Get(ctx, short)
+			if err != nil {
+				return err
+			}
+		}
+		// несуществующая или удаленная ссылка завершает цепочку
+		if data.OriginalURL == "" || data.DeletedFlag {
+			return nil
+		}
+		originalURL = data.OriginalURL
+		if data.Passthrough {
+			originalURL, err = urlnorm.Join(originalURL, rest, query)
+			// недопустимый остаток пути отклоняется при переходе
+			if err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// ownShortURL Короткая ссылка, остаток пути и параметры запроса, если адрес указывает на собственный ShortURLHost.
+// Короткой ссылкой считается первый сегмент пути после базового пути ShortURLHost
+func ownShortURL(rawURL string) (short, rest, query string, ok bool) {
+	if config.Options.ShortURLHost == "" {
+		return "", "", "", false
+	}
+	base, err := url.Parse(urlnorm.Canonical(config.Options.ShortURLHost))
+	if err != nil {
+		return "", "", "", false
+	}
+	u, err := url.Parse(urlnorm.Canonical(rawURL))
+	if err != nil || !strings.EqualFold(u.Host, base.Host) {
+		return "", "", "", false
+	}
+	path, ok := strings.CutPrefix(u.EscapedPath(), strings.TrimSuffix(base.EscapedPath(), "/")+"/")
+	if !ok {
+		return "", "", "", false
+	}
+	short, rest, _ = strings.Cut(path, "/")
+	if short == "" {
+		return "", "", "", false
+	}
+	return short, rest, u.RawQuery, true
+}
@@ -0,0 +1,84 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_CheckChain(t *testing.T) {
+	ctx := context.Background()
+	config.Options.ShortURLHost = "http://localhost:8080"
+	defer func() {
+		config.Options.ShortURLHost = ""
+		config.Options.RedirectMaxDepth = 0
+	}()
+	stor, err := storage.NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	// a -> внешний адрес, b -> a, c -> b, x <-> y
+	for short, target := range map[string]string{
+		"a": "https://example.com/",
+		"b": "http://localhost:8080/a",
+		"c": "http://LOCALHOST:8080/b",
+		"x": "http://localhost:8080/y",
+		"y": "http://localhost:8080/x",
+	} {
+		if err = stor.Post(ctx, &storage.URLData{ShortURL: short, OriginalURL: target}); err != nil {
+			panic(err)
+		}
+	}
+	// p <-> q сквозные, путь после ссылки передается дальше
+	for short, target := range map[string]string{
+		"p": "http://localhost:8080/q",
+		"q": "http://localhost:8080/p",
+	} {
+		if err = stor.Post(ctx, &storage.URLData{ShortURL: short, OriginalURL: target, Passthrough: true}); err != nil {
+			panic(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		maxDepth   int
+		shortURL   string
+		url        string
+		wantReason string
+	}{
+		{"external", 0, "", "https://example.com/", ""},
+		{"own host not a link", 0, "", "http://localhost:8080/api/shorten/batch", ""},
+		{"self reference forbidden", 0, "", "http://localhost:8080/a", ReasonSelfReference},
+		{"one hop", 2, "", "http://localhost:8080/a", ""},
+		{"two hops", 2, "", "http://localhost:8080/b", ""},
+		{"too deep", 2, "", "http://localhost:8080/c", ReasonChainTooDeep},
+		{"unknown link", 2, "", "http://localhost:8080/zzz", ""},
+		{"loop", 5, "", "http://localhost:8080/x", ReasonRedirectLoop},
+		{"points to itself", 5, "a", "http://localhost:8080/a", ReasonRedirectLoop},
+		{"path under link", 5, "", "http://localhost:8080/a/x", ""},
+		{"path under unknown link", 0, "", "http://localhost:8080/zzz/x", ""},
+		{"passthrough points to itself", 5, "p", "http://localhost:8080/p/", ReasonRedirectLoop},
+		{"path under passthrough loop", 5, "", "http://localhost:8080/p/x", ReasonRedirectLoop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Options.RedirectMaxDepth = tt.maxDepth
+			err := CheckChain(ctx, stor, tt.shortURL, tt.url)
+			if tt.wantReason == "" {
+				if !assert.NoError(t, err) {
+					panic(fmt.Errorf("unexpected error: %w", err))
+				}
+				return
+			}
+			var violation *Violation
+			if !assert.True(t, errors.As(err, &violation)) {
+				panic(fmt.Errorf("violation expected, actual %v", err))
+			}
+			assert.Equal(t, tt.wantReason, violation.Reason)
+		})
+	}
+}
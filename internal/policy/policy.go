@@ -0,0 +1,250 @@
+// Package policy Проверка адресов назначения по спискам доменов, подсетям и шаблонам
+package policy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/metrics"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Причины отклонения ссылки
+const (
+	ReasonDomainDenied     = "domain_denied"
+	ReasonDomainNotAllowed = "domain_not_allowed"
+	ReasonPrivateAddress   = "private_address"
+	ReasonPatternDenied    = "pattern_denied"
+)
+
+// Violation Ссылка нарушает политику
+type Violation struct {
+	Reason string `json:"reason"`
+	Rule   string `json:"rule"`
+}
+
+// Error Текст ошибки
+func (v *Violation) Error() string {
+	return fmt.Sprintf("ссылка запрещена политикой: %s (%s)", v.Reason, v.Rule)
+}
+
+// Policy Набор правил проверки адресов назначения
+type Policy struct {
+	allow   map[string]bool
+	deny    map[string]bool
+	nets    []*net.IPNet
+	regexps []*regexp.Regexp
+	resolve bool
+	// результаты проверки сохраненных ссылок, живут до перезагрузки политики
+	cache sync.Map
+	// время изменения файлов, по которым собрана политика
+	mtimes map[string]time.Time
+}
+
+// current Действующая политика
+var current atomic.Pointer[Policy]
+
+// Current Действующая политика. Пустая, если не загружена
+func Current() *Policy {
+	p := current.Load()
+	if p == nil {
+		return &Policy{}
+	}
+	return p
+}
+
+// Set Замена действующей политики
+func Set(p *Policy) {
+	current.Store(p)
+}
+
+// Load Сборка политики по конфигурации
+func Load() (*Policy, error) {
+	p := &Policy{
+		resolve: config.Options.PolicyResolve,
+		mtimes:  map[string]time.Time{},
+	}
+	var err error
+	if p.allow, err = p.readDomains(config.Options.PolicyAllowFile); err != nil {
+		return nil, err
+	}
+	if p.deny, err = p.readDomains(config.Options.PolicyDenyFile); err != nil {
+		return nil, err
+	}
+	patterns, err := p.readLines(config.Options.PolicyRegexFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("шаблон %q: %w", pattern, err)
+		}
+		p.regexps = append(p.regexps, re)
+	}
+	for _, cidr := range config.Options.PolicyDenyCIDRs {
+		_, ipnet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("подсеть %q: %w", cidr, err)
+		}
+		p.nets = append(p.nets, ipnet)
+	}
+	return p, nil
+}
+
+// Changed Изменились ли файлы политики после загрузки
+func (p *Policy) Changed() bool {
+	for filename, mtime := range p.mtimes {
+		info, err := os.Stat(filename)
+		if err != nil || !info.ModTime().Equal(mtime) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check Проверка адреса назначения. Нарушение возвращается как *Violation
+func (p *Policy) Check(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, re := range p.regexps {
+		if re.MatchString(rawURL) {
+			return reject(ReasonPatternDenied, re.String())
+		}
+	}
+	if domain, ok := match(p.deny, host); ok {
+		return reject(ReasonDomainDenied, domain)
+	}
+	if _, ok := match(p.allow, host); len(p.allow) > 0 && !ok {
+		return reject(ReasonDomainNotAllowed, host)
+	}
+	if len(p.nets) == 0 {
+		return nil
+	}
+	ip, err := urlnorm.HostIP(host)
+	if err != nil {
+		return err
+	}
+	ips := []net.IP{ip}
+	switch name := strings.TrimSuffix(host, "."); {
+	case ip != nil:
+	case name == "localhost" || strings.HasSuffix(name, ".localhost"):
+		// localhost всегда указывает на loopback (RFC 6761), резолвер для этого не нужен
+		ips = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	case !p.resolve:
+		return nil
+	default:
+		// неразрешимый хост не запрещаем, адрес может появиться позже
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		for _, ipnet := range p.nets {
+			if ipnet.Contains(ip) {
+				return reject(ReasonPrivateAddress, ipnet.String())
+			}
+		}
+	}
+	return nil
+}
+
+// CheckStored Проверка сохраненной ссылки при переходе.
+// Результат запоминается до смены политики, поэтому повторно ссылка проверяется только после изменения списков
+func (p *Policy) CheckStored(ctx context.Context, rawURL string) error {
+	if v, ok := p.cache.Load(rawURL); ok {
+		if v == nil {
+			return nil
+		}
+		return v.(error)
+	}
+	err := p.Check(ctx, rawURL)
+	var violation *Violation
+	if err != nil && !errors.As(err, &violation) {
+		return nil
+	}
+	p.cache.Store(rawURL, err)
+	return err
+}
+
+// reject Нарушение политики с учетом в метриках
+func reject(reason, rule string) error {
+	metrics.PolicyRejected.WithLabelValues(reason).Inc()
+	return &Violation{Reason: reason, Rule: rule}
+}
+
+// match Поиск домена или одного из его родительских доменов в списке
+func match(domains map[string]bool, host string) (string, bool) {
+	for host != "" {
+		if domains[host] {
+			return host, true
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			break
+		}
+		host = parent
+	}
+	return "", false
+}
+
+// readDomains Чтение списка доменов из файла
+func (p *Policy) readDomains(filename string) (map[string]bool, error) {
+	lines, err := p.readLines(filename)
+	if err != nil {
+		return nil, err
+	}
+	domains := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		domains[strings.TrimSuffix(strings.ToLower(line), ".")] = true
+	}
+	return domains, nil
+}
+
+// readLines Чтение непустых строк файла без комментариев.
+// Пустое имя файла - пустой список
+func (p *Policy) readLines(filename string) ([]string, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	p.mtimes[filename] = info.ModTime()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,126 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFile Запись файла списка во временный каталог
+func writeFile(t *testing.T, name, content string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		panic(err)
+	}
+	return filename
+}
+
+func Test_Check(t *testing.T) {
+	config.Options.PolicyDenyFile = writeFile(t, "deny", "# фишинг\nevil.com\nBad.Example.\n")
+	config.Options.PolicyRegexFile = writeFile(t, "regex", `\.exe$`+"\n")
+	config.Options.PolicyDenyCIDRs = []string{"10.0.0.0/8", "127.0.0.0/8", "::1/128"}
+	defer func() {
+		config.Options.PolicyDenyFile = ""
+		config.Options.PolicyRegexFile = ""
+		config.Options.PolicyAllowFile = ""
+		config.Options.PolicyDenyCIDRs = nil
+	}()
+	p, err := Load()
+	if err != nil {
+		panic(err)
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		wantReason string
+	}{
+		{"allowed", "https://example.com/", ""},
+		{"denied domain", "https://evil.com/login", ReasonDomainDenied},
+		{"denied subdomain", "https://www.evil.com/", ReasonDomainDenied},
+		{"not a subdomain", "https://notevil.com/", ""},
+		{"denied case", "https://bad.example/", ReasonDomainDenied},
+		{"pattern", "https://example.com/setup.exe", ReasonPatternDenied},
+		{"private ip", "http://10.1.2.3/admin", ReasonPrivateAddress},
+		{"loopback ipv6", "http://[::1]/", ReasonPrivateAddress},
+		{"public ip", "http://8.8.8.8/", ""},
+		{"loopback", "http://127.0.0.1/", ReasonPrivateAddress},
+		{"loopback decimal", "http://2130706433/", ReasonPrivateAddress},
+		{"loopback hex", "http://0x7f000001/", ReasonPrivateAddress},
+		{"loopback short", "http://127.1/", ReasonPrivateAddress},
+		{"loopback octal", "http://0177.0.0.1/", ReasonPrivateAddress},
+		{"private hex parts", "http://0xa.0.0.1/", ReasonPrivateAddress},
+		{"public decimal", "http://134744072/", ""},
+		{"localhost", "http://localhost:8080/", ReasonPrivateAddress},
+		{"localhost subdomain", "http://app.LOCALHOST./", ReasonPrivateAddress},
+		{"localhost lookalike", "http://localhost.example.com/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check(context.Background(), tt.url)
+			var violation *Violation
+			if tt.wantReason == "" {
+				if !assert.NoError(t, err) {
+					panic(fmt.Errorf("unexpected error: %w", err))
+				}
+				return
+			}
+			if !assert.True(t, errors.As(err, &violation)) {
+				panic(fmt.Errorf("violation expected, actual %v", err))
+			}
+			assert.Equal(t, tt.wantReason, violation.Reason)
+		})
+	}
+}
+
+func Test_AllowList(t *testing.T) {
+	config.Options.PolicyAllowFile = writeFile(t, "allow", "example.com\n")
+	defer func() { config.Options.PolicyAllowFile = "" }()
+	p, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	assert.NoError(t, p.Check(context.Background(), "https://docs.example.com/"))
+	var violation *Violation
+	assert.True(t, errors.As(p.Check(context.Background(), "https://other.org/"), &violation))
+	assert.Equal(t, ReasonDomainNotAllowed, violation.Reason)
+}
+
+func Test_CheckStoredAfterReload(t *testing.T) {
+	config.Options.PolicyDenyFile = writeFile(t, "deny", "")
+	defer func() {
+		config.Options.PolicyDenyFile = ""
+		Set(nil)
+	}()
+	p, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	Set(p)
+	ctx := context.Background()
+	assert.NoError(t, Current().CheckStored(ctx, "https://evil.com/"))
+	assert.False(t, Current().Changed())
+
+	// список изменился: новая политика заново проверяет сохраненные ссылки
+	if err = os.WriteFile(config.Options.PolicyDenyFile, []byte("evil.com\n"), 0600); err != nil {
+		panic(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err = os.Chtimes(config.Options.PolicyDenyFile, future, future); err != nil {
+		panic(err)
+	}
+	assert.True(t, Current().Changed())
+	p, err = Load()
+	if err != nil {
+		panic(err)
+	}
+	Set(p)
+	var violation *Violation
+	assert.True(t, errors.As(Current().CheckStored(ctx, "https://evil.com/"), &violation))
+}
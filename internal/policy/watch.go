@@ -0,0 +1,32 @@
+// Package policy реализует перезагрузку политики при изменении файлов
+package policy
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Watch Периодическая проверка файлов политики и перезагрузка при изменении.
+// Ошибка загрузки оставляет действующую политику
+func Watch(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !Current().Changed() {
+				continue
+			}
+			p, err := Load()
+			if err != nil {
+				log.Error("failed to reload policy", zap.Error(err))
+				continue
+			}
+			Set(p)
+			log.Info("policy reloaded")
+		}
+	}
+}
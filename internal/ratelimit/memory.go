@@ -0,0 +1,78 @@
+// Package ratelimit реализует хранение корзин токенов в памяти
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval Период удаления заполненных корзин
+const sweepInterval = time.Minute
+
+// bucket Корзина токенов
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// refill Пополнение корзины на момент now
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+}
+
+// MemLimiter Ограничитель с корзинами в памяти одного экземпляра сервиса
+type MemLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewMemLimiter Создание ограничителя в памяти
+func NewMemLimiter() *MemLimiter {
+	return &MemLimiter{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Allow Списание токена из корзины key
+func (m *MemLimiter) Allow(_ context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now, limit: limit}
+		m.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now)
+	if b.tokens < 1 {
+		return false, limit.retryAfter(b.tokens), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+// sweep Удаление заполненных корзин: они ничем не отличаются от новых
+func (m *MemLimiter) sweep(now time.Time) {
+	if now.Sub(m.swept) < sweepInterval {
+		return
+	}
+	m.swept = now
+	for key, b := range m.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Close Закрытие ограничителя
+func (m *MemLimiter) Close() error {
+	return nil
+}
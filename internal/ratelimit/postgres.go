@@ -0,0 +1,84 @@
+// Package ratelimit реализует общие для нескольких экземпляров сервиса корзины токенов в СУБД postgres
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/gerasimovpavel/shortener.git/internal/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// PgLimiter Ограничитель с корзинами в СУБД Postgres
+type PgLimiter struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgLimiter Создание ограничителя в Postgres
+func NewPgLimiter(ps string) (*PgLimiter, error) {
+	config, err := pgxpool.ParseConfig(ps)
+	if err != nil {
+		return nil, err
+	}
+	config.MaxConns = 10
+	config.ConnConfig.Tracer = tracing.PgxTracer{}
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = pool.Exec(context.Background(),
+		`CREATE UNLOGGED TABLE IF NOT EXISTS public.rate_limits
+(
+    key text COLLATE pg_catalog."default" NOT NULL PRIMARY KEY,
+    tokens double precision NOT NULL,
+    updated_at timestamptz NOT NULL
+)`,
+	)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &PgLimiter{pool: pool}, nil
+}
+
+// Allow Списание токена из корзины key.
+// Пополнение и списание выполняются одним оператором, поэтому экземпляры сервиса не мешают друг другу
+func (pgl *PgLimiter) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	var tokens float64
+	err := pgl.pool.QueryRow(ctx,
+		`INSERT INTO rate_limits AS r (key, tokens, updated_at) VALUES ($1, $3::float8 - 1, now())
+				ON CONFLICT (key) DO UPDATE
+				SET tokens = LEAST($3::float8, r.tokens + EXTRACT(EPOCH FROM now() - r.updated_at) * $2::float8) - 1,
+					updated_at = now()
+				WHERE LEAST($3::float8, r.tokens + EXTRACT(EPOCH FROM now() - r.updated_at) * $2::float8) >= 1
+				RETURNING tokens`,
+		key,
+		limit.Rate,
+		limit.Burst,
+	).Scan(&tokens)
+	if err == nil {
+		return true, 0, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return false, 0, err
+	}
+	// токенов нет, считаем, когда появится следующий
+	err = pgl.pool.QueryRow(ctx,
+		`SELECT LEAST($2::float8, tokens + EXTRACT(EPOCH FROM now() - updated_at) * $3::float8) FROM rate_limits WHERE key=$1`,
+		key,
+		limit.Burst,
+		limit.Rate,
+	).Scan(&tokens)
+	if err != nil {
+		return false, 0, err
+	}
+	return false, limit.retryAfter(tokens), nil
+}
+
+// Close Закрытие ограничителя
+func (pgl *PgLimiter) Close() error {
+	pgl.pool.Close()
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package ratelimit реализует ограничение частоты запросов по алгоритму token bucket
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Группы маршрутов с отдельными ограничениями
+const (
+	// GroupRedirect Переходы по коротким ссылкам
+	GroupRedirect = "redirect"
+	// GroupShorten Создание одиночных ссылок
+	GroupShorten = "shorten"
+	// GroupBatch Пакетное создание ссылок
+	GroupBatch = "batch"
+	// GroupAuth Регистрация, вход и выход
+	GroupAuth = "auth"
+	// GroupUser Работа со ссылками и ключами пользователя
+	GroupUser = "user"
+	// GroupPassword Попытки ввода пароля ссылки, корзина у каждой пары ссылки и IP клиента
+	GroupPassword = "password"
+)
+
+// Limit Ограничение: Rate токенов в секунду, не более Burst подряд
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled Ограничение задано
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// retryAfter Время до появления следующего токена, если сейчас их tokens
+func (l Limit) retryAfter(tokens float64) time.Duration {
+	return time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+}
+
+// Limiter Хранилище состояния корзин токенов
+type Limiter interface {
+	// Allow Списание токена из корзины key. Если токенов нет, возвращает время до появления следующего
+	Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+	Close() error
+}
+
+var (
+	// Lim Глобальный ограничитель. nil - ограничение отключено
+	Lim Limiter
+	// Limits Ограничения по группам маршрутов
+	Limits = map[string]Limit{}
+)
+
+// ParseLimit Разбор ограничения в формате "rate:burst", например "10:20".
+// Пустая строка или 0 - без ограничения
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+	rate, burst, ok := strings.Cut(s, ":")
+	if !ok {
+		burst = rate
+	}
+	l := Limit{}
+	var err error
+	l.Rate, err = strconv.ParseFloat(rate, 64)
+	if err != nil || l.Rate < 0 {
+		return Limit{}, fmt.Errorf("неверная частота %q", s)
+	}
+	l.Burst, err = strconv.Atoi(burst)
+	if err != nil || l.Burst < 0 {
+		return Limit{}, fmt.Errorf("неверный запас %q", s)
+	}
+	return l, nil
+}
+
+// ParseLimits Разбор ограничений по группам в формате "group=rate:burst"
+func ParseLimits(items []string) (map[string]Limit, error) {
+	limits := map[string]Limit{}
+	for _, item := range items {
+		group, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("ограничение %q: ожидается group=rate:burst", item)
+		}
+		l, err := ParseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("группа %s: %w", group, err)
+		}
+		limits[strings.TrimSpace(group)] = l
+	}
+	return limits, nil
+}
+
+// NewLimiter Создание ограничителя по конфигурации.
+// Общий для нескольких экземпляров сервиса ограничитель хранится в Postgres
+func NewLimiter() (Limiter, error) {
+	if config.Options.RateLimitShared {
+		if config.Options.DatabaseDSN == "" {
+			return nil, fmt.Errorf("общий ограничитель требует DATABASE_DSN")
+		}
+		return NewPgLimiter(config.Options.DatabaseDSN)
+	}
+	return NewMemLimiter(), nil
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_ParseLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []string
+		want    map[string]Limit
+		wantErr bool
+	}{
+		{"rate and burst", []string{"redirect=50:100", "batch=0.5:2"}, map[string]Limit{"redirect": {50, 100}, "batch": {0.5, 2}}, false},
+		{"burst equals rate", []string{"auth=5"}, map[string]Limit{"auth": {5, 5}}, false},
+		{"disabled", []string{"user=0"}, map[string]Limit{"user": {}}, false},
+		{"no group", []string{"10:20"}, nil, true},
+		{"bad rate", []string{"auth=x:1"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLimits(tt.in)
+			if !assert.Equal(t, tt.wantErr, err != nil) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_MemLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	m := NewMemLimiter()
+	m.now = func() time.Time { return now }
+	limit := Limit{Rate: 2, Burst: 3}
+
+	// запас расходуется подряд, дальше - отказ
+	for i := 0; i < limit.Burst; i++ {
+		ok, _, err := m.Allow(ctx, "a", limit)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+	ok, retry, err := m.Allow(ctx, "a", limit)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retry)
+
+	// корзины разных ключей независимы
+	ok, _, _ = m.Allow(ctx, "b", limit)
+	assert.True(t, ok)
+
+	// через полсекунды появляется один токен
+	now = now.Add(500 * time.Millisecond)
+	ok, _, _ = m.Allow(ctx, "a", limit)
+	assert.True(t, ok)
+	ok, _, _ = m.Allow(ctx, "a", limit)
+	assert.False(t, ok)
+
+	// заполненные корзины удаляются
+	now = now.Add(time.Hour)
+	m.Allow(ctx, "c", limit)
+	assert.Len(t, m.buckets, 1)
+}
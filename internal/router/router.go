@@ -3,41 +3,68 @@ package router
 
 import (
 	"github.com/gerasimovpavel/shortener.git/internal/handlers"
+	"github.com/gerasimovpavel/shortener.git/internal/metrics"
 	mw "github.com/gerasimovpavel/shortener.git/internal/middleware"
-	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"github.com/gerasimovpavel/shortener.git/internal/ratelimit"
+	"github.com/gerasimovpavel/shortener.git/internal/users"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
 )
 
-// MainRouter роутер http запросов
-func MainRouter() chi.Router {
-	// делаем регистратор SugaredLogger
-	mw.Sugar = *logger.Logger.Sugar()
-
+// MainRouter роутер http запросов.
+// log - логгер приложения, accessLog - логгер запросов
+func MainRouter(log *zap.Logger, accessLog *zap.Logger) chi.Router {
 	r := chi.NewRouter()
+	r.Use(
+		mw.RequestID(log),
+		mw.Tracing,
+		mw.Logger(accessLog),
+	)
 	r.Mount("/debug", middleware.Profiler())
-	r.Get("/{shortURL}", handlers.GetHandler)
+	r.Handle("/metrics", metrics.Handler())
+	r.With(mw.RateLimit(ratelimit.GroupRedirect)).Get("/{shortURL}", handlers.GetHandler)
+	r.With(mw.RateLimit(ratelimit.GroupRedirect)).Get("/{shortURL}/*", handlers.GetHandler)
+	r.With(mw.RateLimit(ratelimit.GroupRedirect)).Post("/{shortURL}", handlers.PasswordHandler)
+	r.With(mw.RateLimit(ratelimit.GroupRedirect)).Post("/{shortURL}/*", handlers.PasswordHandler)
 	r.Get("/ping", handlers.PingHandler)
+	r.Route("/api/auth", func(r chi.Router) {
+		r.Use(mw.RateLimit(ratelimit.GroupAuth), mw.Gzip)
+		r.Post("/register", handlers.RegisterHandler)
+		r.Post("/login", handlers.LoginHandler)
+		r.Post("/logout", handlers.LogoutHandler)
+	})
 	r.Group(func(r chi.Router) {
 		r.Use(
 			mw.AutoAuthHeader,
-			mw.Logger(logger.Logger),
 			mw.Gzip,
 		)
-		r.Post("/", handlers.PostHandler)
+		r.With(mw.RequireScope(users.ScopeShorten), mw.RateLimit(ratelimit.GroupShorten)).Post("/", handlers.PostHandler)
 		r.Route("/api", func(r chi.Router) {
 			r.Route("/shorten", func(r chi.Router) {
-				r.Post("/", handlers.PostJSONHandler)
-				r.Post("/batch", handlers.PostJSONBatchHandler)
+				r.Use(mw.RequireScope(users.ScopeShorten))
+				r.With(mw.RateLimit(ratelimit.GroupShorten)).Post("/", handlers.PostJSONHandler)
+				r.With(mw.RateLimit(ratelimit.GroupBatch)).Post("/batch", handlers.PostJSONBatchHandler)
 			})
 
 			r.Route("/user", func(r chi.Router) {
-				r.Delete("/urls", handlers.DeleteUserURLHandler)
+				r.Use(mw.RateLimit(ratelimit.GroupUser))
+				r.With(mw.RequireScope(users.ScopeDelete)).Delete("/urls", handlers.DeleteUserURLHandler)
 				r.Group(func(r chi.Router) {
 					r.Use(mw.AuthHeader)
-					r.Get("/urls", handlers.GetUserURLHandler)
+					r.With(mw.RequireScope(users.ScopeRead)).Get("/urls", handlers.GetUserURLHandler)
+					r.With(mw.RequireScope(users.ScopeRead)).Get("/quota", handlers.QuotaHandler)
+					r.With(mw.RequireScope(users.ScopeRead)).Get("/urls/{shortURL}", handlers.GetUserURLByShortHandler)
+					r.With(mw.RequireScope(users.ScopeRead)).Get("/urls/{shortURL}/stats", handlers.GetUserURLStatsHandler)
+					r.With(mw.RequireScope(users.ScopeShorten)).Patch("/urls/{shortURL}", handlers.PatchUserURLHandler)
+					r.With(mw.RequireScope(users.ScopeShorten)).Post("/urls/{shortURL}/sign", handlers.SignUserURLHandler)
+				})
+				r.Route("/keys", func(r chi.Router) {
+					r.Use(mw.AuthHeader, mw.SessionOnly)
+					r.Post("/", handlers.CreateAPIKeyHandler)
+					r.Get("/", handlers.ListAPIKeysHandler)
+					r.Delete("/{id}", handlers.RevokeAPIKeyHandler)
 				})
-
 			})
 
 		})
@@ -15,11 +15,11 @@ func Test_MainRouter(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := logger.NewLogger()
+			l, err := logger.NewLogger(logger.DefaultOptions())
 			if err != nil {
 				panic(fmt.Errorf("failed to create logger: %w", err))
 			}
-			r := MainRouter()
+			r := MainRouter(l, l)
 			if r == nil {
 				panic(errors.New("failed to create main router"))
 			}
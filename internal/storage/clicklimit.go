@@ -0,0 +1,42 @@
+// Package storage реализует ограничение количества переходов по ссылке
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrClicksExhausted Переходы по ссылке исчерпаны
+	ErrClicksExhausted = errors.New("переходы по ссылке исчерпаны")
+	// ErrBadMaxClicks Недопустимое ограничение переходов
+	ErrBadMaxClicks = errors.New("недопустимое ограничение переходов")
+)
+
+// ValidateMaxClicks Проверка ограничения переходов. 0 - без ограничения
+func ValidateMaxClicks(maxClicks int) error {
+	if maxClicks < 0 {
+		return fmt.Errorf("%w: %d", ErrBadMaxClicks, maxClicks)
+	}
+	return nil
+}
+
+// SetMaxClicks Установка ограничения переходов новой ссылки: остаток равен ограничению
+func (d *URLData) SetMaxClicks(maxClicks int) {
+	d.MaxClicks = maxClicks
+	d.RemainingClicks = maxClicks
+}
+
+// ClicksExhausted Переходы по ссылке с ограничением исчерпаны
+func (d *URLData) ClicksExhausted() bool {
+	return d.MaxClicks > 0 && d.RemainingClicks <= 0
+}
+
+// consumeClick Списание перехода по ссылке в памяти. Возвращает остаток переходов
+func (d *URLData) consumeClick() (int, error) {
+	if d.ClicksExhausted() || d.MaxClicks == 0 {
+		return 0, ErrClicksExhausted
+	}
+	d.RemainingClicks--
+	return d.RemainingClicks, nil
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func Test_ConsumeClick(t *testing.T) {
+	mem, err := NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	file, err := NewFileWorker(filepath.Join(t.TempDir(), "urls.json"))
+	if err != nil {
+		panic(err)
+	}
+	tests := []struct {
+		name string
+		stor Storage
+	}{
+		{"map", mem},
+		{"file", file},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			data := &URLData{OriginalURL: gofakeit.URL(), UserID: gofakeit.UUID()}
+			data.SetMaxClicks(5)
+			assert.NoError(t, tt.stor.Post(ctx, data))
+			unlimited := &URLData{OriginalURL: gofakeit.URL(), UserID: data.UserID}
+			assert.NoError(t, tt.stor.Post(ctx, unlimited))
+
+			// одновременные переходы не превышают ограничение, а чтения идут вперемешку с их списанием
+			var ok atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					if _, err := tt.stor.ConsumeClick(ctx, data.ShortURL); err == nil {
+						ok.Add(1)
+					} else {
+						assert.ErrorIs(t, err, ErrClicksExhausted)
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					got, err := tt.stor.Get(ctx, data.ShortURL)
+					if assert.NoError(t, err) {
+						assert.Equal(t, data.ShortURL, got.ShortURL)
+					}
+					urls, err := tt.stor.GetUserURL(ctx, data.UserID)
+					assert.NoError(t, err)
+					assert.Len(t, urls, 2)
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, int32(5), ok.Load())
+			saved, err := tt.stor.Get(ctx, data.ShortURL)
+			assert.NoError(t, err)
+			assert.True(t, saved.ClicksExhausted())
+
+			_, err = tt.stor.ConsumeClick(ctx, unlimited.ShortURL)
+			assert.ErrorIs(t, err, ErrClicksExhausted)
+
+			// изменение других настроек остаток не сбрасывает, изменение ограничения - сбрасывает
+			saved.CachePolicy = "no-store"
+			assert.NoError(t, tt.stor.UpdateUserURL(ctx, saved))
+			saved, err = tt.stor.Get(ctx, data.ShortURL)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, saved.RemainingClicks)
+			saved.MaxClicks = 2
+			assert.NoError(t, tt.stor.UpdateUserURL(ctx, saved))
+			n, err := tt.stor.ConsumeClick(ctx, data.ShortURL)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+			assert.NoError(t, tt.stor.Close())
+		})
+	}
+	assert.Error(t, ValidateMaxClicks(-1))
+	assert.NoError(t, ValidateMaxClicks(0))
+}
+
+func Test_FileConsumeClick(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	fw, err := NewFileWorker(filename)
+	if err != nil {
+		panic(err)
+	}
+	if err = os.Chmod(filename, 0640); err != nil {
+		panic(err)
+	}
+	data := &URLData{OriginalURL: gofakeit.URL(), UserID: gofakeit.UUID()}
+	data.SetMaxClicks(3)
+	if err = fw.Post(ctx, data); err != nil {
+		panic(err)
+	}
+	before, err := os.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+
+	// переходы не перезаписывают файл ссылок, остаток сохраняется после переоткрытия
+	for i := 0; i < 2; i++ {
+		_, err = fw.ConsumeClick(ctx, data.ShortURL)
+		assert.NoError(t, err)
+	}
+	after, err := os.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, before, after)
+	assert.NoError(t, fw.Close())
+	fw, err = NewFileWorker(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer fw.Close()
+	saved, err := fw.Get(ctx, data.ShortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, saved.RemainingClicks)
+
+	// перезапись файла переносит остаток в файл ссылок и сохраняет права файла
+	saved.CachePolicy = "no-store"
+	assert.NoError(t, fw.UpdateUserURL(ctx, saved))
+	_, err = os.Stat(fw.remainingFile())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	info, err := os.Stat(filename)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	saved, err = fw.Get(ctx, data.ShortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, saved.RemainingClicks)
+}
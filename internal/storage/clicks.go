@@ -0,0 +1,43 @@
+// Package storage реализует учет переходов по ссылкам
+package storage
+
+import (
+	"time"
+)
+
+// Click Переход по короткой ссылке
+type Click struct {
+	ShortURL string    `json:"short_url"`
+	Variant  string    `json:"variant,omitempty"`
+	Country  string    `json:"country,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// ClickStats Статистика переходов по ссылке
+type ClickStats struct {
+	// Всего переходов
+	Clicks int `json:"clicks"`
+	// Переходы по вариантам A/B теста
+	Variants map[string]int `json:"variants,omitempty"`
+	// Переходы по странам клиентов, страна определяется по базе GeoIP
+	Countries map[string]int `json:"countries,omitempty"`
+}
+
+// add Учет перехода в статистике
+func (s *ClickStats) add(click *Click, n int) {
+	s.Clicks += n
+	s.Variants = inc(s.Variants, click.Variant, n)
+	s.Countries = inc(s.Countries, click.Country, n)
+}
+
+// inc Увеличение счетчика key на n. Пустой ключ не учитывается
+func inc(counters map[string]int, key string, n int) map[string]int {
+	if key == "" {
+		return counters
+	}
+	if counters == nil {
+		counters = map[string]int{}
+	}
+	counters[key] += n
+	return counters
+}
@@ -2,18 +2,23 @@
 package storage
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	urlgen "github.com/gerasimovpavel/shortener.git/internal/urlgenerator"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"sync"
 )
 
-// FileWorker Структура для работы с файловым хранилищем
+// FileWorker Структура для работы с файловым хранилищем.
+// Чтения идут под блокировкой на чтение отдельными дескрипторами, запись и перезапись файла - под блокировкой на запись.
+// Остатки переходов дописываются в отдельный файл и переносятся в основной при его перезаписи
 type FileWorker struct {
-	decoder  *json.Decoder
+	mu       sync.RWMutex
 	encoder  *json.Encoder
 	file     *os.File
 	filename string
@@ -30,13 +35,42 @@ func NewFileWorker(filename string) (*FileWorker, error) {
 	return &FileWorker{
 		filename: filename,
 		file:     file,
-		encoder:  json.NewEncoder(file),
-		decoder:  json.NewDecoder(file)}, nil
+		encoder:  json.NewEncoder(file)}, nil
 }
 
+// fileRecord Строка файла ссылок. Признак удаления не отдается в ответах API, поэтому в файле хранится отдельным полем
+type fileRecord struct {
+	URLData
+	Deleted bool `json:"is_deleted,omitempty"`
+}
+
+// decodeRecord Чтение следующей ссылки из файла
+func decodeRecord(decoder *json.Decoder) (*URLData, error) {
+	rec := fileRecord{}
+	err := decoder.Decode(&rec)
+	if err != nil {
+		return nil, err
+	}
+	rec.DeletedFlag = rec.Deleted
+	return &rec.URLData, nil
+}
+
+// encodeRecord Запись ссылки в файл
+func encodeRecord(encoder *json.Encoder, data *URLData) error {
+	return encoder.Encode(fileRecord{URLData: *data, Deleted: data.DeletedFlag})
+}
+
+// remainingRecord Строка файла остатков переходов. Остаток применяется, пока ограничение ссылки не изменилось
+type remainingRecord struct {
+	ShortURL  string `json:"short_url"`
+	MaxClicks int    `json:"max_clicks"`
+	Remaining int    `json:"remaining"`
+}
+
+// refresh Переоткрытие файла для записи после его подмены. Вызывается под блокировкой fw.mu
 func (fw *FileWorker) refresh() error {
 	var err error
-	err = fw.Close()
+	err = fw.file.Close()
 	if err != nil {
 		return err
 	}
@@ -44,38 +78,26 @@ func (fw *FileWorker) refresh() error {
 	if err != nil {
 		return err
 	}
-	fw.decoder = json.NewDecoder(fw.file)
 	fw.encoder = json.NewEncoder(fw.file)
 	return nil
 }
 
-func (fw *FileWorker) rowsCount() (int, error) {
-	var cnt int
-	err := fw.refresh()
+// PostBatch Пакетная запись ссылок. Файл читается один раз, проверки идут по снимку с уже записанными ссылками пакета
+func (fw *FileWorker) PostBatch(ctx context.Context, data []*URLData) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	items, err := fw.readAll()
 	if err != nil {
-		return -1, err
-	}
-	scanner := bufio.NewScanner(fw.file)
-
-	for scanner.Scan() {
-		cnt++
-	}
-
-	if err = scanner.Err(); err != nil {
-		return -1, err
+		return err
 	}
-	return cnt, nil
-}
-
-// PostBatch Пакетная запись ссылок
-func (fw *FileWorker) PostBatch(data []*URLData) error {
 	var errConf error
 	for _, u := range data {
-		err := fw.Post(u)
-		if err != nil && !errors.Is(err, ErrDataConflict) {
+		items, err = fw.post(items, u)
+		if err != nil && !errors.Is(err, ErrDataConflict) && !errors.Is(err, ErrQuotaExceeded) {
 			return err
 		}
 		if err != nil {
+			markBatchItem(u, err)
 			errConf = errors.Join(err, errConf)
 		}
 	}
@@ -83,68 +105,85 @@ func (fw *FileWorker) PostBatch(data []*URLData) error {
 }
 
 // Post Запись ссылки
-func (fw *FileWorker) Post(data *URLData) error {
-	var errConf error
-	if data.ShortURL == "" {
-		data.ShortURL = urlgen.GenShortOptimized()
-	}
-	item, err := fw.FindByOriginalURL(data.OriginalURL)
+func (fw *FileWorker) Post(ctx context.Context, data *URLData) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	items, err := fw.readAll()
 	if err != nil {
 		return err
 	}
+	_, err = fw.post(items, data)
+	return err
+}
 
-	if item.ShortURL != "" {
-		errConf = errors.Join(errConf, ErrDataConflict)
+// post Запись ссылки с проверками по снимку файла items. Вызывается под блокировкой fw.mu.
+// Возвращает снимок с добавленной ссылкой
+func (fw *FileWorker) post(items []URLData, data *URLData) ([]URLData, error) {
+	var errConf error
+	if data.ShortURL == "" {
+		data.ShortURL = urlgen.GenShortOptimized()
 	}
-
-	item, err = fw.Get(data.ShortURL)
-	if err != nil {
-		return err
+	if item := findUserItem(items, data.UserID, data.OriginalURL); item != nil {
+		// ссылка уже сокращена пользователем, возвращаем существующую короткую
+		data.ShortURL = item.ShortURL
+		return items, ErrDataConflict
 	}
-	if item.ShortURL != "" {
+	if item := findItem(items, data.ShortURL); item != nil {
 		errConf = errors.Join(errConf, ErrDataConflict)
 	}
-	uuid, err := fw.rowsCount()
-	if err != nil {
-		return err
+	if q := QuotaFor(data.UserID); q > 0 && countUserItems(items, data.UserID) >= q {
+		return items, ErrQuotaExceeded
 	}
 
-	data.UUID = strconv.Itoa(uuid + 1)
-	return errors.Join(fw.encoder.Encode(&data), errConf)
+	data.UUID = strconv.Itoa(len(items) + 1)
+	err := encodeRecord(fw.encoder, data)
+	if err != nil {
+		return items, err
+	}
+	return append(items, *data), errConf
 }
 
 // Get Чтение оргинальной ссылки по значению короткой ссылки
-func (fw *FileWorker) Get(shortURL string) (*URLData, error) {
+func (fw *FileWorker) Get(ctx context.Context, shortURL string) (*URLData, error) {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	return fw.get(shortURL)
+}
 
-	item := &URLData{}
-	err := fw.refresh()
+// get Чтение ссылки по значению короткой ссылки без блокировки
+func (fw *FileWorker) get(shortURL string) (*URLData, error) {
+	items, err := fw.readAll()
 	if err != nil {
-		return item, err
+		return &URLData{}, err
 	}
-	for {
-		err = fw.decoder.Decode(&item)
-		if err != nil && err != io.EOF {
-			return nil, err
-		}
-		if err == io.EOF {
-			break
-		}
-		if item.ShortURL == shortURL {
-			return item, nil
-		}
+	if item := findItem(items, shortURL); item != nil {
+		return item, nil
 	}
 	return &URLData{}, nil
 }
 
-// FindByOriginalURL поиск по оригинальной ссылки
-func (fw *FileWorker) FindByOriginalURL(originalURL string) (*URLData, error) {
+// findItem Ссылка снимка файла по значению короткой ссылки, nil если ее нет
+func findItem(items []URLData, shortURL string) *URLData {
+	for i := range items {
+		if items[i].ShortURL == shortURL {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
+// FindByOriginalURL поиск по оригинальной ссылки в каноническом виде
+func (fw *FileWorker) FindByOriginalURL(ctx context.Context, originalURL string) (*URLData, error) {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
 	data := &URLData{}
-	items, err := fw.GetAll()
+	items, err := fw.readAll()
 	if err != nil {
 		return data, err
 	}
+	originalURL = urlnorm.Canonical(originalURL)
 	for _, item := range items {
-		if item.OriginalURL == originalURL {
+		if urlnorm.Canonical(item.OriginalURL) == originalURL {
 			data = &item
 			break
 		}
@@ -152,61 +191,338 @@ func (fw *FileWorker) FindByOriginalURL(originalURL string) (*URLData, error) {
 	return data, nil
 }
 
+// findUserItem Ссылка снимка файла пользователя userID по оригинальной ссылке в каноническом виде, nil если ее нет
+func findUserItem(items []URLData, userID, originalURL string) *URLData {
+	originalURL = urlnorm.Canonical(originalURL)
+	for i := range items {
+		if items[i].UserID == userID && urlnorm.Canonical(items[i].OriginalURL) == originalURL {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
 // GetAll Чтение все ссылок в хранилище
 func (fw *FileWorker) GetAll() ([]URLData, error) {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	return fw.readAll()
+}
+
+// readAll Чтение всех ссылок без блокировки. Файл читается своим дескриптором,
+// поэтому одновременные чтения не мешают друг другу
+func (fw *FileWorker) readAll() ([]URLData, error) {
 	items := []URLData{}
-	err := fw.refresh()
+	f, err := os.Open(fw.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
 	if err != nil {
-		return items, err
+		return nil, err
 	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
 	for {
-		item := URLData{}
-		err := fw.decoder.Decode(&item)
+		// каждая запись читается в новую ссылку, иначе поля с omitempty достаются от предыдущих записей
+		item, err := decodeRecord(decoder)
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			return nil, err
 		}
-		items = append(items, item)
+		items = append(items, *item)
+	}
+	return items, fw.applyRemaining(items)
+}
+
+// remainingFile Файл остатков переходов рядом с файлом ссылок
+func (fw *FileWorker) remainingFile() string {
+	return fw.filename + ".remaining"
+}
+
+// applyRemaining Применение остатков переходов, списанных после последней перезаписи файла ссылок
+func (fw *FileWorker) applyRemaining(items []URLData) error {
+	f, err := os.Open(fw.remainingFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	index := make(map[string]int, len(items))
+	for i := range items {
+		index[items[i].ShortURL] = i
+	}
+	decoder := json.NewDecoder(f)
+	for {
+		rec := remainingRecord{}
+		err = decoder.Decode(&rec)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if i, ok := index[rec.ShortURL]; ok && items[i].MaxClicks == rec.MaxClicks {
+			items[i].RemainingClicks = rec.Remaining
+		}
 	}
-	return items, nil
 }
 
 // Ping Проверка доступности файлового хранилища
-func (fw *FileWorker) Ping() error {
+func (fw *FileWorker) Ping(_ context.Context) error {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
 	return fw.file.Sync()
 }
 
 // Close Закрытие хранилища
 func (fw *FileWorker) Close() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
 	return fw.file.Close()
 }
 
 // GetUserURL Чтение ссылок определенного пользователя
-func (fw *FileWorker) GetUserURL(userID string) ([]*URLData, error) {
+func (fw *FileWorker) GetUserURL(ctx context.Context, userID string) ([]*URLData, error) {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
 	urls := []*URLData{}
-	err := fw.refresh()
+	items, err := fw.readAll()
 	if err != nil {
 		return urls, err
 	}
-	item := &URLData{}
-	for {
-		err = fw.decoder.Decode(&item)
-		if err != nil && err != io.EOF {
-			return nil, err
+	for i := range items {
+		if items[i].UserID == userID {
+			urls = append(urls, &items[i])
 		}
+	}
+	return urls, nil
+}
+
+// DeleteUserURL Удаление ссылок определенного пользователя
+func (fw *FileWorker) DeleteUserURL(ctx context.Context, urls []*URLData) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	items, err := fw.readAll()
+	if err != nil {
+		return err
+	}
+	var n int
+	for _, deldata := range urls {
+		for i := range items {
+			data := &items[i]
+			if data.UserID == deldata.UserID && data.ShortURL == deldata.ShortURL && !data.DeletedFlag {
+				data.DeletedFlag = true
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	return fw.rewrite(items)
+}
+
+// Stats Статистика хранилища
+func (fw *FileWorker) Stats(_ context.Context) (*Stats, error) {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	items, err := fw.readAll()
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{}
+	users := map[string]struct{}{}
+	for _, data := range items {
+		if !data.DeletedFlag {
+			stats.URLs++
+		}
+		if data.UserID != "" {
+			users[data.UserID] = struct{}{}
+		}
+	}
+	stats.Users = len(users)
+	return stats, nil
+}
+
+// TransferUserURL Передача всех ссылок пользователя fromUserID пользователю toUserID.
+// Ссылки на адреса, уже сокращенные toUserID, остаются у fromUserID
+func (fw *FileWorker) TransferUserURL(_ context.Context, fromUserID, toUserID string) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	items, err := fw.readAll()
+	if err != nil {
+		return 0, err
+	}
+	owned := map[string]bool{}
+	for _, item := range items {
+		if item.UserID == toUserID {
+			owned[urlnorm.Canonical(item.OriginalURL)] = true
+		}
+	}
+	var n int
+	for i := range items {
+		if items[i].UserID == fromUserID && !owned[urlnorm.Canonical(items[i].OriginalURL)] {
+			items[i].UserID = toUserID
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, fw.rewrite(items)
+}
+
+// UpdateUserURL Изменение настроек ссылки пользователя
+func (fw *FileWorker) UpdateUserURL(_ context.Context, data *URLData) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	items, err := fw.readAll()
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		item := &items[i]
+		if item.ShortURL == data.ShortURL && item.UserID == data.UserID && !item.DeletedFlag {
+			item.applySettings(data)
+			return fw.rewrite(items)
+		}
+	}
+	return ErrURLNotFound
+}
+
+// rewrite Перезапись файла целиком: ссылки пишутся во временный файл с правами основного, который его подменяет.
+// Остатки переходов уже применены к items, поэтому их файл удаляется
+func (fw *FileWorker) rewrite(items []URLData) error {
+	info, err := os.Stat(fw.filename)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fw.filename), filepath.Base(fw.filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = tmp.Chmod(info.Mode().Perm())
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	encoder := json.NewEncoder(tmp)
+	for i := range items {
+		err = encodeRecord(encoder, &items[i])
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	err = errors.Join(tmp.Sync(), tmp.Close())
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), fw.filename)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(fw.remainingFile())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return fw.refresh()
+}
+
+// countUserItems Количество активных ссылок пользователя в снимке файла
+func countUserItems(items []URLData, userID string) int {
+	var n int
+	for _, data := range items {
+		if data.UserID == userID && !data.DeletedFlag {
+			n++
+		}
+	}
+	return n
+}
+
+// CountUserURL Количество активных ссылок пользователя
+func (fw *FileWorker) CountUserURL(_ context.Context, userID string) (int, error) {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	items, err := fw.readAll()
+	if err != nil {
+		return 0, err
+	}
+	return countUserItems(items, userID), nil
+}
+
+// clicksFile Файл переходов рядом с файлом ссылок
+func (fw *FileWorker) clicksFile() string {
+	return fw.filename + ".clicks"
+}
+
+// AddClick Учет перехода по ссылке, переходы дописываются в отдельный файл
+func (fw *FileWorker) AddClick(_ context.Context, click *Click) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	f, err := os.OpenFile(fw.clicksFile(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	return errors.Join(json.NewEncoder(f).Encode(click), f.Close())
+}
+
+// ClickStats Статистика переходов по ссылке
+func (fw *FileWorker) ClickStats(_ context.Context, shortURL string) (*ClickStats, error) {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	stats := &ClickStats{}
+	f, err := os.Open(fw.clicksFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	for {
+		click := &Click{}
+		err = decoder.Decode(click)
 		if err == io.EOF {
-			break
+			return stats, nil
 		}
-		if item.UserID == userID {
-			urls = append(urls, item)
+		if err != nil {
+			return nil, err
+		}
+		if click.ShortURL == shortURL {
+			stats.add(click, 1)
 		}
 	}
-	return urls, nil
 }
 
-// DeleteUserURL Удаление ссылок определенного пользователя
-func (fw *FileWorker) DeleteUserURL(urls []*URLData) error {
-	return nil
+// ConsumeClick Списание перехода по ссылке с ограничением под блокировкой.
+// Новый остаток дописывается в файл остатков, файл ссылок не перезаписывается
+func (fw *FileWorker) ConsumeClick(_ context.Context, shortURL string) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	items, err := fw.readAll()
+	if err != nil {
+		return 0, err
+	}
+	for i := range items {
+		if items[i].ShortURL == shortURL {
+			n, err := items[i].consumeClick()
+			if err != nil {
+				return 0, err
+			}
+			f, err := os.OpenFile(fw.remainingFile(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+			if err != nil {
+				return 0, err
+			}
+			rec := remainingRecord{ShortURL: shortURL, MaxClicks: items[i].MaxClicks, Remaining: n}
+			return n, errors.Join(json.NewEncoder(f).Encode(rec), f.Close())
+		}
+	}
+	return 0, ErrClicksExhausted
 }
@@ -0,0 +1,156 @@
+// Package storage реализует сбор метрик и трассировку операций хранилища
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/gerasimovpavel/shortener.git/internal/metrics"
+	"github.com/gerasimovpavel/shortener.git/internal/tracing"
+	"github.com/gerasimovpavel/shortener.git/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"time"
+)
+
+// InstrumentedStorage Хранилище с учетом времени выполнения операций и трассировкой
+type InstrumentedStorage struct {
+	next    Storage
+	backend string
+}
+
+// NewInstrumentedStorage Создание хранилища с учетом метрик
+func NewInstrumentedStorage(next Storage, backend string) *InstrumentedStorage {
+	return &InstrumentedStorage{next: next, backend: backend}
+}
+
+// Get Чтение оргинальной ссылки по значению короткой ссылки
+func (s *InstrumentedStorage) Get(ctx context.Context, shortURL string) (data *URLData, err error) {
+	ctx, end := s.start(ctx, "Get", attribute.String("short_url", shortURL))
+	defer func() { end(err) }()
+	return s.next.Get(ctx, shortURL)
+}
+
+// Post Запись ссылки
+func (s *InstrumentedStorage) Post(ctx context.Context, data *URLData) (err error) {
+	ctx, end := s.start(ctx, "Post")
+	defer func() { end(err) }()
+	return s.next.Post(ctx, data)
+}
+
+// PostBatch Пакетная запись ссылок
+func (s *InstrumentedStorage) PostBatch(ctx context.Context, urls []*URLData) (err error) {
+	ctx, end := s.start(ctx, "PostBatch", attribute.Int("batch_size", len(urls)))
+	defer func() { end(err) }()
+	return s.next.PostBatch(ctx, urls)
+}
+
+// FindByOriginalURL поиск по оригинальной ссылки
+func (s *InstrumentedStorage) FindByOriginalURL(ctx context.Context, originalURL string) (data *URLData, err error) {
+	ctx, end := s.start(ctx, "FindByOriginalURL")
+	defer func() { end(err) }()
+	return s.next.FindByOriginalURL(ctx, originalURL)
+}
+
+// Ping Проверка доступности хранилища
+func (s *InstrumentedStorage) Ping(ctx context.Context) (err error) {
+	ctx, end := s.start(ctx, "Ping")
+	defer func() { end(err) }()
+	return s.next.Ping(ctx)
+}
+
+// Close Закрытие хранилища
+func (s *InstrumentedStorage) Close() (err error) {
+	_, end := s.start(context.Background(), "Close")
+	defer func() { end(err) }()
+	return s.next.Close()
+}
+
+// GetUserURL Чтение ссылок определенного пользователя
+func (s *InstrumentedStorage) GetUserURL(ctx context.Context, userID string) (urls []*URLData, err error) {
+	ctx, end := s.start(ctx, "GetUserURL")
+	defer func() { end(err) }()
+	return s.next.GetUserURL(ctx, userID)
+}
+
+// DeleteUserURL Удаление ссылок определенного пользователя
+func (s *InstrumentedStorage) DeleteUserURL(ctx context.Context, urls []*URLData) (err error) {
+	ctx, end := s.start(ctx, "DeleteUserURL", attribute.Int("batch_size", len(urls)))
+	defer func() { end(err) }()
+	return s.next.DeleteUserURL(ctx, urls)
+}
+
+// Stats Статистика хранилища
+func (s *InstrumentedStorage) Stats(ctx context.Context) (stats *Stats, err error) {
+	ctx, end := s.start(ctx, "Stats")
+	defer func() { end(err) }()
+	return s.next.Stats(ctx)
+}
+
+// TransferUserURL Передача ссылок от одного пользователя другому
+func (s *InstrumentedStorage) TransferUserURL(ctx context.Context, fromUserID, toUserID string) (n int, err error) {
+	ctx, end := s.start(ctx, "TransferUserURL")
+	defer func() { end(err) }()
+	return s.next.TransferUserURL(ctx, fromUserID, toUserID)
+}
+
+// CountUserURL Количество активных ссылок пользователя
+func (s *InstrumentedStorage) CountUserURL(ctx context.Context, userID string) (n int, err error) {
+	ctx, end := s.start(ctx, "CountUserURL")
+	defer func() { end(err) }()
+	return s.next.CountUserURL(ctx, userID)
+}
+
+// UpdateUserURL Изменение настроек ссылки пользователя
+func (s *InstrumentedStorage) UpdateUserURL(ctx context.Context, data *URLData) (err error) {
+	ctx, end := s.start(ctx, "UpdateUserURL", attribute.String("short_url", data.ShortURL))
+	defer func() { end(err) }()
+	return s.next.UpdateUserURL(ctx, data)
+}
+
+// AddClick Учет перехода по ссылке
+func (s *InstrumentedStorage) AddClick(ctx context.Context, click *Click) (err error) {
+	ctx, end := s.start(ctx, "AddClick", attribute.String("short_url", click.ShortURL))
+	defer func() { end(err) }()
+	return s.next.AddClick(ctx, click)
+}
+
+// ClickStats Статистика переходов по ссылке
+func (s *InstrumentedStorage) ClickStats(ctx context.Context, shortURL string) (stats *ClickStats, err error) {
+	ctx, end := s.start(ctx, "ClickStats", attribute.String("short_url", shortURL))
+	defer func() { end(err) }()
+	return s.next.ClickStats(ctx, shortURL)
+}
+
+// ConsumeClick Списание перехода по ссылке с ограничением
+func (s *InstrumentedStorage) ConsumeClick(ctx context.Context, shortURL string) (n int, err error) {
+	ctx, end := s.start(ctx, "ConsumeClick", attribute.String("short_url", shortURL))
+	defer func() { end(err) }()
+	return s.next.ConsumeClick(ctx, shortURL)
+}
+
+// start Начало операции: открывает дочерний span и возвращает функцию для ее завершения.
+// Конфликт дубликатов, превышение квоты, отсутствие ссылки и исчерпанные переходы ошибкой хранилища не считаются
+func (s *InstrumentedStorage) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	start := time.Now()
+	attrs = append(attrs, attribute.String("storage.backend", s.backend))
+	ctx, span := tracing.Tracer().Start(ctx, "storage."+method, trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		if errors.Is(err, ErrDataConflict) || errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrURLNotFound) ||
+			errors.Is(err, ErrClicksExhausted) {
+			err = nil
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			logger.FromContext(ctx).Error("storage operation failed",
+				zap.String("backend", s.backend),
+				zap.String("method", method),
+				zap.Error(err),
+			)
+		}
+		span.End()
+		metrics.ObserveStorage(s.backend, method, start, err)
+	}
+}
@@ -2,12 +2,20 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	urlgen "github.com/gerasimovpavel/shortener.git/internal/urlgenerator"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
+	"maps"
+	"sync"
 )
 
 // MapStorage Хранилище в памяти
-type MapStorage []URLData
+type MapStorage struct {
+	// блокировка хранилища: чтения под блокировкой на чтение, изменения - на запись
+	mu   sync.RWMutex
+	urls []URLData
+}
 
 // NewMemWorker Создание нового хранилища
 func NewMemWorker() (*MapStorage, error) {
@@ -15,34 +23,56 @@ func NewMemWorker() (*MapStorage, error) {
 }
 
 // Get Чтение оргинальной ссылки по значению короткой ссылки
-func (m *MapStorage) Get(shortURL string) (*URLData, error) {
-	for _, data := range *m {
+func (m *MapStorage) Get(ctx context.Context, shortURL string) (*URLData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.get(shortURL), nil
+}
+
+// get Копия ссылки по значению короткой ссылки без блокировки
+func (m *MapStorage) get(shortURL string) *URLData {
+	for _, data := range m.urls {
 		if data.ShortURL == shortURL {
-			return &data, nil
+			return &data
 		}
 	}
-	return &URLData{}, nil
+	return &URLData{}
 }
 
-// FindByOriginalURL поиск по оригинальной ссылки
-func (m *MapStorage) FindByOriginalURL(originalURL string) (*URLData, error) {
-	for _, data := range *m {
-		if data.OriginalURL == originalURL {
+// FindByOriginalURL поиск по оригинальной ссылки в каноническом виде
+func (m *MapStorage) FindByOriginalURL(ctx context.Context, originalURL string) (*URLData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	originalURL = urlnorm.Canonical(originalURL)
+	for _, data := range m.urls {
+		if urlnorm.Canonical(data.OriginalURL) == originalURL {
 			return &data, nil
 		}
 	}
 	return &URLData{}, nil
 }
 
+// findUserURL Ссылка пользователя userID по оригинальной ссылке в каноническом виде, nil если ее нет
+func (m *MapStorage) findUserURL(userID, originalURL string) *URLData {
+	originalURL = urlnorm.Canonical(originalURL)
+	for i := range m.urls {
+		if m.urls[i].UserID == userID && urlnorm.Canonical(m.urls[i].OriginalURL) == originalURL {
+			return &m.urls[i]
+		}
+	}
+	return nil
+}
+
 // PostBatch Пакетная запись ссылок
-func (m *MapStorage) PostBatch(data []*URLData) error {
+func (m *MapStorage) PostBatch(ctx context.Context, data []*URLData) error {
 	var errConf error
 	for _, u := range data {
-		err := m.Post(u)
-		if err != nil && !errors.Is(err, ErrDataConflict) {
+		err := m.Post(ctx, u)
+		if err != nil && !errors.Is(err, ErrDataConflict) && !errors.Is(err, ErrQuotaExceeded) {
 			return err
 		}
 		if err != nil {
+			markBatchItem(u, err)
 			errConf = errors.Join(err, errConf)
 		}
 	}
@@ -50,31 +80,30 @@ func (m *MapStorage) PostBatch(data []*URLData) error {
 }
 
 // Post Запись ссылки
-func (m *MapStorage) Post(data *URLData) error {
+func (m *MapStorage) Post(ctx context.Context, data *URLData) error {
 	var errConf error
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if data.ShortURL == "" {
 		data.ShortURL = urlgen.GenShortOptimized()
 	}
-	item, err := m.FindByOriginalURL(data.OriginalURL)
-	if err != nil {
-		return err
+	if item := m.findUserURL(data.UserID, data.OriginalURL); item != nil {
+		// ссылка уже сокращена пользователем, возвращаем существующую короткую
+		data.ShortURL = item.ShortURL
+		return ErrDataConflict
 	}
-	if item.ShortURL != "" {
+	if item := m.get(data.ShortURL); item.ShortURL != "" {
 		errConf = errors.Join(errConf, ErrDataConflict)
 	}
-	item, err = m.Get(data.ShortURL)
-	if err != nil {
-		return err
-	}
-	if item.ShortURL != "" {
-		errConf = errors.Join(errConf, ErrDataConflict)
+	if q := QuotaFor(data.UserID); q > 0 && m.countUserURL(data.UserID) >= q {
+		return ErrQuotaExceeded
 	}
-	*m = append(*m, *data)
+	m.urls = append(m.urls, *data)
 	return errors.Join(nil, errConf)
 }
 
 // Ping Проверка доступности файлового хранилища
-func (m *MapStorage) Ping() error {
+func (m *MapStorage) Ping(_ context.Context) error {
 	return nil
 }
 
@@ -85,10 +114,13 @@ func (m *MapStorage) Close() error {
 }
 
 // GetUserURL Чтение ссылок определенного пользователя
-func (m *MapStorage) GetUserURL(userID string) ([]*URLData, error) {
+func (m *MapStorage) GetUserURL(ctx context.Context, userID string) ([]*URLData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	urls := []*URLData{}
-	for _, data := range *m {
+	for _, data := range m.urls {
 		if data.UserID == userID {
+			data := data
 			urls = append(urls, &data)
 		}
 	}
@@ -96,9 +128,12 @@ func (m *MapStorage) GetUserURL(userID string) ([]*URLData, error) {
 }
 
 // DeleteUserURL Удаление ссылок определенного пользователя
-func (m *MapStorage) DeleteUserURL(urls []*URLData) error {
+func (m *MapStorage) DeleteUserURL(ctx context.Context, urls []*URLData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for _, deldata := range urls {
-		for _, data := range *m {
+		for i := range m.urls {
+			data := &m.urls[i]
 			if data.UserID == deldata.UserID && data.ShortURL == deldata.ShortURL && !data.DeletedFlag {
 				data.DeletedFlag = true
 			}
@@ -106,3 +141,109 @@ func (m *MapStorage) DeleteUserURL(urls []*URLData) error {
 	}
 	return nil
 }
+
+// Stats Статистика хранилища
+func (m *MapStorage) Stats(_ context.Context) (*Stats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := &Stats{}
+	users := map[string]struct{}{}
+	for _, data := range m.urls {
+		if !data.DeletedFlag {
+			stats.URLs++
+		}
+		if data.UserID != "" {
+			users[data.UserID] = struct{}{}
+		}
+	}
+	stats.Users = len(users)
+	return stats, nil
+}
+
+// TransferUserURL Передача всех ссылок пользователя fromUserID пользователю toUserID.
+// Ссылки на адреса, уже сокращенные toUserID, остаются у fromUserID. Возвращает количество переданных ссылок
+func (m *MapStorage) TransferUserURL(_ context.Context, fromUserID, toUserID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int
+	for i := range m.urls {
+		if m.urls[i].UserID == fromUserID && m.findUserURL(toUserID, m.urls[i].OriginalURL) == nil {
+			m.urls[i].UserID = toUserID
+			n++
+		}
+	}
+	return n, nil
+}
+
+// countUserURL Количество активных ссылок пользователя
+func (m *MapStorage) countUserURL(userID string) int {
+	var n int
+	for _, data := range m.urls {
+		if data.UserID == userID && !data.DeletedFlag {
+			n++
+		}
+	}
+	return n
+}
+
+// CountUserURL Количество активных ссылок пользователя
+func (m *MapStorage) CountUserURL(_ context.Context, userID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.countUserURL(userID), nil
+}
+
+// UpdateUserURL Изменение настроек ссылки пользователя
+func (m *MapStorage) UpdateUserURL(_ context.Context, data *URLData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.urls {
+		item := &m.urls[i]
+		if item.ShortURL == data.ShortURL && item.UserID == data.UserID && !item.DeletedFlag {
+			item.applySettings(data)
+			return nil
+		}
+	}
+	return ErrURLNotFound
+}
+
+// AddClick Учет перехода по ссылке
+func (m *MapStorage) AddClick(_ context.Context, click *Click) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.urls {
+		if m.urls[i].ShortURL == click.ShortURL {
+			m.urls[i].clicks.add(click, 1)
+			return nil
+		}
+	}
+	return ErrURLNotFound
+}
+
+// ClickStats Статистика переходов по ссылке
+func (m *MapStorage) ClickStats(_ context.Context, shortURL string) (*ClickStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, data := range m.urls {
+		if data.ShortURL == shortURL {
+			return &ClickStats{
+				Clicks:    data.clicks.Clicks,
+				Variants:  maps.Clone(data.clicks.Variants),
+				Countries: maps.Clone(data.clicks.Countries),
+			}, nil
+		}
+	}
+	return &ClickStats{}, nil
+}
+
+// ConsumeClick Списание перехода по ссылке с ограничением
+func (m *MapStorage) ConsumeClick(_ context.Context, shortURL string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.urls {
+		if m.urls[i].ShortURL == shortURL {
+			return m.urls[i].consumeClick()
+		}
+	}
+	return 0, ErrClicksExhausted
+}
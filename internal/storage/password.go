@@ -0,0 +1,54 @@
+// Package storage реализует защиту ссылок паролем
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Допустимая длина пароля ссылки в байтах, bcrypt учитывает не больше 72 байт
+const (
+	minPasswordLen = 4
+	maxPasswordLen = 72
+)
+
+// ErrBadPassword Недопустимый пароль ссылки
+var ErrBadPassword = errors.New("недопустимый пароль")
+
+// SetPassword Установка пароля ссылки. Пустой пароль снимает защиту
+func (d *URLData) SetPassword(password string) error {
+	if password == "" {
+		d.PasswordHash = ""
+		return nil
+	}
+	if len(password) < minPasswordLen || len(password) > maxPasswordLen {
+		return fmt.Errorf("%w: длина от %d до %d байт", ErrBadPassword, minPasswordLen, maxPasswordLen)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	d.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword Совпадает ли пароль с паролем ссылки
+func (d *URLData) CheckPassword(password string) bool {
+	return d.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(d.PasswordHash), []byte(password)) == nil
+}
+
+// PasswordFingerprint Отпечаток хэша пароля. Токены доступа привязываются к нему,
+// поэтому смена пароля отзывает выданные токены
+func (d *URLData) PasswordFingerprint() string {
+	sum := sha256.Sum256([]byte(d.PasswordHash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// HidePassword Замена хэша пароля признаком защиты перед выдачей ссылки владельцу
+func (d *URLData) HidePassword() {
+	d.Protected = d.PasswordHash != ""
+	d.PasswordHash = ""
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_SetPassword(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		wantErr   bool
+		protected bool
+	}{
+		{"no password", "", false, false},
+		{"password", "secret", false, true},
+		{"too short", "abc", true, false},
+		{"too long", strings.Repeat("x", 73), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &URLData{}
+			err := data.SetPassword(tt.password)
+			if !assert.Equal(t, tt.wantErr, err != nil) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+			assert.Equal(t, tt.protected, data.PasswordHash != "")
+			assert.NotContains(t, data.PasswordHash, "secret")
+			assert.Equal(t, tt.protected, data.CheckPassword(tt.password))
+			assert.False(t, data.CheckPassword("wrong"))
+		})
+	}
+}
+
+func Test_PasswordFingerprint(t *testing.T) {
+	data := &URLData{}
+	assert.NoError(t, data.SetPassword("secret"))
+	before := data.PasswordFingerprint()
+	assert.NoError(t, data.SetPassword("secret"))
+	// у нового хэша новая соль, поэтому отпечаток меняется даже при том же пароле
+	assert.NotEqual(t, before, data.PasswordFingerprint())
+
+	data.HidePassword()
+	assert.True(t, data.Protected)
+	assert.Empty(t, data.PasswordHash)
+}
+
+func Test_UpdatePassword(t *testing.T) {
+	mem, err := NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	file, err := NewFileWorker(filepath.Join(t.TempDir(), "urls.json"))
+	if err != nil {
+		panic(err)
+	}
+	tests := []struct {
+		name string
+		stor Storage
+	}{
+		{"map", mem},
+		{"file", file},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			data := &URLData{OriginalURL: gofakeit.URL(), UserID: gofakeit.UUID()}
+			assert.NoError(t, data.SetPassword("secret"))
+			assert.NoError(t, tt.stor.Post(ctx, data))
+			saved, err := tt.stor.Get(ctx, data.ShortURL)
+			assert.NoError(t, err)
+			assert.True(t, saved.CheckPassword("secret"))
+
+			assert.NoError(t, saved.SetPassword(""))
+			assert.NoError(t, tt.stor.UpdateUserURL(ctx, saved))
+			saved, err = tt.stor.Get(ctx, data.ShortURL)
+			assert.NoError(t, err)
+			assert.Empty(t, saved.PasswordHash)
+			assert.NoError(t, tt.stor.Close())
+		})
+	}
+}
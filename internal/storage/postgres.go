@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/gerasimovpavel/shortener.git/internal/tracing"
 	urlgen "github.com/gerasimovpavel/shortener.git/internal/urlgenerator"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"strconv"
@@ -27,6 +29,7 @@ func NewPostgreWorker(ps string) (*PgWorker, error) {
 		return nil, err
 	}
 	config.MaxConns = 50
+	config.ConnConfig.Tracer = tracing.PgxTracer{}
 	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	//conn, err := pgx.Connect(context.Background(), ps)
 	if err != nil {
@@ -44,6 +47,38 @@ func NewPostgreWorker(ps string) (*PgWorker, error) {
     is_deleted boolean NOT NULL DEFAULT false,
     CONSTRAINT "urls_originalURL_userID_key" UNIQUE ("originalURL", "userID")
 )`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = pool.Exec(context.Background(),
+		`ALTER TABLE public.urls
+    ADD COLUMN IF NOT EXISTS redirect_code integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS cache_policy text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS passthrough boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS rules jsonb NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS variants jsonb NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS password_hash text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS max_clicks integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS remaining_clicks integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS not_before timestamptz,
+    ADD COLUMN IF NOT EXISTS not_after timestamptz,
+    ADD COLUMN IF NOT EXISTS fallback_url text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS require_signature boolean NOT NULL DEFAULT false`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = pool.Exec(context.Background(),
+		`CREATE TABLE IF NOT EXISTS public.clicks
+(
+    "shortURL" text COLLATE pg_catalog."default" NOT NULL,
+    variant text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    country text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+ALTER TABLE public.clicks ADD COLUMN IF NOT EXISTS country text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS clicks_shortURL_idx ON public.clicks ("shortURL")`,
 	)
 	if err != nil {
 		return nil, err
@@ -51,9 +86,9 @@ func NewPostgreWorker(ps string) (*PgWorker, error) {
 	return &PgWorker{pool: pool}, nil
 }
 
-func (pgw *PgWorker) rowsCount() (int, error) {
+func (pgw *PgWorker) rowsCount(ctx context.Context) (int, error) {
 	var cnt int
-	err := pgw.pool.QueryRow(context.Background(), `SELECT COUNT(uuid) FROM public.urls`).Scan(&cnt)
+	err := pgw.pool.QueryRow(ctx, `SELECT COUNT(uuid) FROM public.urls`).Scan(&cnt)
 	if err != nil && err != pgx.ErrNoRows {
 		return -1, err
 	}
@@ -62,10 +97,10 @@ func (pgw *PgWorker) rowsCount() (int, error) {
 }
 
 // Get Чтение оргинальной ссылки по значению короткой ссылки
-func (pgw *PgWorker) Get(shortURL string) (*URLData, error) {
+func (pgw *PgWorker) Get(ctx context.Context, shortURL string) (*URLData, error) {
 	urls := []URLData{}
 	data := &URLData{}
-	err := pgxscan.Select(context.Background(), pgw.pool, &urls, `SELECT uuid, "originalURL", "shortURL", is_deleted, "userID" FROM public.urls WHERE "shortURL"=$1`, shortURL)
+	err := pgxscan.Select(ctx, pgw.pool, &urls, `SELECT uuid, "originalURL", "shortURL", is_deleted, "userID", redirect_code, cache_policy, passthrough, rules, variants, password_hash, max_clicks, remaining_clicks, not_before, not_after, fallback_url, require_signature FROM public.urls WHERE "shortURL"=$1`, shortURL)
 	if err != nil && err != pgx.ErrNoRows {
 		return data, err
 	}
@@ -76,10 +111,11 @@ func (pgw *PgWorker) Get(shortURL string) (*URLData, error) {
 	return data, nil
 }
 
-// FindByOriginalURL поиск по оригинальной ссылки
-func (pgw *PgWorker) FindByOriginalURL(originalURL string) (*URLData, error) {
+// FindByOriginalURL поиск по оригинальной ссылки в каноническом виде.
+// Ссылки нормализуются перед записью, поэтому в таблице уже канонические
+func (pgw *PgWorker) FindByOriginalURL(ctx context.Context, originalURL string) (*URLData, error) {
 	data := URLData{}
-	row := pgw.pool.QueryRow(context.Background(), `SELECT uuid, "shortURL", "originalURL"FROM urls where "originalURL"=$1`, originalURL)
+	row := pgw.pool.QueryRow(ctx, `SELECT uuid, "shortURL", "originalURL", "userID" FROM urls WHERE "originalURL"=$1`, urlnorm.Canonical(originalURL))
 
 	err := row.Scan(&data.UUID, &data.ShortURL, &data.OriginalURL, &data.UserID)
 	if err != nil && err != pgx.ErrNoRows {
@@ -90,9 +126,8 @@ func (pgw *PgWorker) FindByOriginalURL(originalURL string) (*URLData, error) {
 }
 
 // PostBatch Пакетная запись ссылок
-func (pgw *PgWorker) PostBatch(urls []*URLData) error {
+func (pgw *PgWorker) PostBatch(ctx context.Context, urls []*URLData) error {
 	var err, errConf error
-	ctx := context.Background()
 
 	tx, err := pgw.pool.Begin(ctx)
 	if err != nil {
@@ -100,15 +135,16 @@ func (pgw *PgWorker) PostBatch(urls []*URLData) error {
 	}
 
 	for _, data := range urls {
-		err = pgw.Post(data)
-		if err != nil && !errors.Is(err, ErrDataConflict) {
+		err = pgw.Post(ctx, data)
+		if err != nil && !errors.Is(err, ErrDataConflict) && !errors.Is(err, ErrQuotaExceeded) {
 			err2 := tx.Rollback(ctx)
 			if err2 != nil {
 				return fmt.Errorf("ошибка rollback: %w", err2)
 			}
 			return err
 		}
-		if errors.Is(err, ErrDataConflict) {
+		if errors.Is(err, ErrDataConflict) || errors.Is(err, ErrQuotaExceeded) {
+			markBatchItem(data, err)
 			errConf = errors.Join(errConf, err)
 		}
 
@@ -121,44 +157,79 @@ func (pgw *PgWorker) PostBatch(urls []*URLData) error {
 	return errors.Join(nil, errConf)
 }
 
-// Post Запись ссылки
-func (pgw *PgWorker) Post(data *URLData) error {
-	var errConf error
+// Post Запись ссылки.
+// При заданной квоте записи пользователя выполняются под транзакционной блокировкой,
+// и ссылка сверх квоты откатывается
+func (pgw *PgWorker) Post(ctx context.Context, data *URLData) error {
 	if data.ShortURL == "" {
 		data.ShortURL = urlgen.GenShortOptimized()
 	}
 
-	uuid, err := pgw.rowsCount()
+	uuid, err := pgw.rowsCount(ctx)
 	if err != nil {
 		return err
 	}
 	data.UUID = strconv.Itoa(uuid + 1)
 
-	//_, err = pgw.Exec(context.Background(), `INSERT INTO urls (uuid, "shortURL", "originalURL") VALUES ($1,$2,$3)`, data.UUID, data.ShortURL, data.OriginalURL)
+	tx, err := pgw.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка tx create: %w", err)
+	}
+	// после Commit откат ничего не делает
+	defer tx.Rollback(ctx)
+
+	quota := QuotaFor(data.UserID)
+	if quota > 0 {
+		_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, data.UserID)
+		if err != nil {
+			return err
+		}
+	}
 
-	err = pgw.pool.QueryRow(context.Background(),
-		`INSERT INTO urls (uuid, "shortURL", "originalURL", "userID") 
-				VALUES ($1,$2,$3,$4) 
+	err = tx.QueryRow(ctx,
+		`INSERT INTO urls (uuid, "shortURL", "originalURL", "userID", redirect_code, cache_policy, passthrough, rules, variants, password_hash, max_clicks, remaining_clicks, not_before, not_after, fallback_url, require_signature) 
+				VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16) 
 				ON CONFLICT ("originalURL","userID") DO UPDATE SET status='conflict' RETURNING "shortURL", "originalURL", status`,
 		data.UUID,
 		data.ShortURL,
 		data.OriginalURL,
 		data.UserID,
+		data.RedirectCode,
+		data.CachePolicy,
+		data.Passthrough,
+		rulesJSON(data.Rules),
+		variantsJSON(data.Variants),
+		data.PasswordHash,
+		data.MaxClicks,
+		data.RemainingClicks,
+		data.NotBefore,
+		data.NotAfter,
+		data.FallbackURL,
+		data.RequireSignature,
 	).Scan(&data.ShortURL, &data.OriginalURL, &data.UUID)
-
 	if err != nil {
 		return err
 	}
 	if strings.EqualFold(strings.Trim(data.UUID, " "), "conflict") {
-		errConf = errors.Join(errConf, ErrDataConflict)
+		return errors.Join(tx.Commit(ctx), ErrDataConflict)
 	}
 
-	return errors.Join(nil, errConf)
+	if quota > 0 {
+		var n int
+		err = tx.QueryRow(ctx, `SELECT COUNT(*) FROM urls WHERE "userID"=$1 AND NOT is_deleted`, data.UserID).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > quota {
+			return ErrQuotaExceeded
+		}
+	}
+	return tx.Commit(ctx)
 }
 
 // Ping Проверка доступности файлового хранилища
-func (pgw *PgWorker) Ping() error {
-	return pgw.pool.Ping(context.Background())
+func (pgw *PgWorker) Ping(ctx context.Context) error {
+	return pgw.pool.Ping(ctx)
 }
 
 // Close Закрытие хранилища
@@ -168,9 +239,9 @@ func (pgw *PgWorker) Close() error {
 }
 
 // GetUserURL Чтение ссылок определенного пользователя
-func (pgw *PgWorker) GetUserURL(userID string) ([]*URLData, error) {
+func (pgw *PgWorker) GetUserURL(ctx context.Context, userID string) ([]*URLData, error) {
 	urls := []*URLData{}
-	err := pgxscan.Select(context.Background(), pgw.pool, &urls, `SELECT "originalURL", "shortURL" FROM urls WHERE "userID"=$1`, userID)
+	err := pgxscan.Select(ctx, pgw.pool, &urls, `SELECT "originalURL", "shortURL", redirect_code, cache_policy, passthrough, rules, variants, password_hash, max_clicks, remaining_clicks, not_before, not_after, fallback_url, require_signature FROM urls WHERE "userID"=$1`, userID)
 	if err != nil {
 		return urls, err
 	}
@@ -178,7 +249,7 @@ func (pgw *PgWorker) GetUserURL(userID string) ([]*URLData, error) {
 }
 
 // DeleteUserURL Удаление ссылок определенного пользователя
-func (pgw *PgWorker) DeleteUserURL(urls []*URLData) error {
+func (pgw *PgWorker) DeleteUserURL(ctx context.Context, urls []*URLData) error {
 
 	valueStrings := make([]string, 0, len(urls))
 	valueArgs := make([]interface{}, 0, len(urls)*2)
@@ -198,6 +269,137 @@ func (pgw *PgWorker) DeleteUserURL(urls []*URLData) error {
 					WHERE x."shortURL"=u."shortURL" AND x."userID"=u."userID"`,
 		strings.Join(valueStrings, ","))
 
-	_, err := pgw.pool.Exec(context.Background(), stmt, valueArgs...)
+	_, err := pgw.pool.Exec(ctx, stmt, valueArgs...)
+	return err
+}
+
+// Stats Статистика хранилища
+func (pgw *PgWorker) Stats(ctx context.Context) (*Stats, error) {
+	stats := &Stats{}
+	err := pgw.pool.QueryRow(ctx,
+		`SELECT COUNT(*) FILTER (WHERE NOT is_deleted), COUNT(DISTINCT NULLIF("userID", '')) FROM urls`,
+	).Scan(&stats.URLs, &stats.Users)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// TransferUserURL Передача всех ссылок пользователя fromUserID пользователю toUserID.
+// Ссылки, которые у toUserID уже есть, остаются у прежнего владельца
+func (pgw *PgWorker) TransferUserURL(ctx context.Context, fromUserID, toUserID string) (int, error) {
+	tag, err := pgw.pool.Exec(ctx,
+		`UPDATE urls AS u SET "userID"=$2
+				WHERE u."userID"=$1
+				AND NOT EXISTS (SELECT 1 FROM urls AS d WHERE d."userID"=$2 AND d."originalURL"=u."originalURL")`,
+		fromUserID,
+		toUserID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// CountUserURL Количество активных ссылок пользователя
+func (pgw *PgWorker) CountUserURL(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := pgw.pool.QueryRow(ctx, `SELECT COUNT(*) FROM urls WHERE "userID"=$1 AND NOT is_deleted`, userID).Scan(&n)
+	return n, err
+}
+
+// UpdateUserURL Изменение настроек ссылки пользователя
+func (pgw *PgWorker) UpdateUserURL(ctx context.Context, data *URLData) error {
+	tag, err := pgw.pool.Exec(ctx,
+		`UPDATE urls SET redirect_code=$3, cache_policy=$4, passthrough=$5, rules=$6, variants=$7, password_hash=$8,
+				max_clicks=$9, remaining_clicks=CASE WHEN max_clicks<>$9 THEN $9 ELSE remaining_clicks END,
+				not_before=$10, not_after=$11, fallback_url=$12, require_signature=$13
+				WHERE "shortURL"=$1 AND "userID"=$2 AND NOT is_deleted`,
+		data.ShortURL,
+		data.UserID,
+		data.RedirectCode,
+		data.CachePolicy,
+		data.Passthrough,
+		rulesJSON(data.Rules),
+		variantsJSON(data.Variants),
+		data.PasswordHash,
+		data.MaxClicks,
+		data.NotBefore,
+		data.NotAfter,
+		data.FallbackURL,
+		data.RequireSignature,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrURLNotFound
+	}
+	return nil
+}
+
+// rulesJSON Правила ссылки для записи в jsonb. Отсутствие правил - пустой массив
+func rulesJSON(rules []Rule) []Rule {
+	if rules == nil {
+		return []Rule{}
+	}
+	return rules
+}
+
+// variantsJSON Варианты ссылки для записи в jsonb. Отсутствие вариантов - пустой массив
+func variantsJSON(variants []Variant) []Variant {
+	if variants == nil {
+		return []Variant{}
+	}
+	return variants
+}
+
+// AddClick Учет перехода по ссылке
+func (pgw *PgWorker) AddClick(ctx context.Context, click *Click) error {
+	_, err := pgw.pool.Exec(ctx,
+		`INSERT INTO clicks ("shortURL", variant, country, created_at) VALUES ($1, $2, $3, $4)`,
+		click.ShortURL,
+		click.Variant,
+		click.Country,
+		click.Time,
+	)
 	return err
 }
+
+// ClickStats Статистика переходов по ссылке
+func (pgw *PgWorker) ClickStats(ctx context.Context, shortURL string) (*ClickStats, error) {
+	rows, err := pgw.pool.Query(ctx,
+		`SELECT variant, country, COUNT(*) FROM clicks WHERE "shortURL"=$1 GROUP BY variant, country`,
+		shortURL,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := &ClickStats{}
+	for rows.Next() {
+		click := &Click{}
+		var n int
+		if err = rows.Scan(&click.Variant, &click.Country, &n); err != nil {
+			return nil, err
+		}
+		stats.add(click, n)
+	}
+	return stats, rows.Err()
+}
+
+// ConsumeClick Списание перехода по ссылке с ограничением одним условным UPDATE:
+// при одновременных переходах остаток не уходит ниже нуля
+func (pgw *PgWorker) ConsumeClick(ctx context.Context, shortURL string) (int, error) {
+	var n int
+	err := pgw.pool.QueryRow(ctx,
+		`UPDATE urls SET remaining_clicks=remaining_clicks-1
+				WHERE "shortURL"=$1 AND max_clicks>0 AND remaining_clicks>0 AND NOT is_deleted
+				RETURNING remaining_clicks`,
+		shortURL,
+	).Scan(&n)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrClicksExhausted
+	}
+	return n, err
+}
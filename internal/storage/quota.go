@@ -0,0 +1,50 @@
+// Package storage реализует квоты пользователей на количество ссылок
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"strconv"
+	"strings"
+)
+
+// ErrQuotaExceeded Пользователь достиг квоты активных ссылок
+var ErrQuotaExceeded = errors.New("превышена квота ссылок")
+
+// QuotaOverrides Индивидуальные квоты пользователей
+var QuotaOverrides = map[string]int{}
+
+// QuotaFor Квота активных ссылок пользователя. 0 - без ограничения
+func QuotaFor(userID string) int {
+	if q, ok := QuotaOverrides[userID]; ok {
+		return q
+	}
+	return config.Options.UserQuota
+}
+
+// ParseQuotaOverrides Разбор индивидуальных квот в формате "userID=N"
+func ParseQuotaOverrides(items []string) (map[string]int, error) {
+	overrides := map[string]int{}
+	for _, item := range items {
+		userID, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("квота %q: ожидается userID=N", item)
+		}
+		q, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || q < 0 {
+			return nil, fmt.Errorf("квота %q: неверное значение", item)
+		}
+		overrides[strings.TrimSpace(userID)] = q
+	}
+	return overrides, nil
+}
+
+// markBatchItem Учет результата записи элемента пакета.
+// Элемент сверх квоты не сохраняется и помечается ошибкой
+func markBatchItem(data *URLData, err error) {
+	if errors.Is(err, ErrQuotaExceeded) {
+		data.ShortURL = ""
+		data.Error = ErrQuotaExceeded.Error()
+	}
+}
@@ -0,0 +1,78 @@
+// Package storage реализует параметры перенаправления ссылок
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrURLNotFound Ссылка пользователя не найдена
+	ErrURLNotFound = errors.New("ссылка не найдена")
+	// ErrBadRedirectCode Недопустимый код перенаправления
+	ErrBadRedirectCode = errors.New("недопустимый код перенаправления")
+	// ErrBadCachePolicy Недопустимая политика кэширования
+	ErrBadCachePolicy = errors.New("недопустимая политика кэширования")
+)
+
+// RedirectCodes Допустимые коды перенаправления
+var RedirectCodes = []int{
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+// cacheDirectives Допустимые директивы Cache-Control и нужно ли им значение
+var cacheDirectives = map[string]bool{
+	"no-store":        false,
+	"no-cache":        false,
+	"private":         false,
+	"public":          false,
+	"must-revalidate": false,
+	"immutable":       false,
+	"max-age":         true,
+	"s-maxage":        true,
+}
+
+// ValidateRedirect Проверка кода перенаправления и политики кэширования.
+// Нулевые значения означают настройки сервера по умолчанию
+func ValidateRedirect(code int, cachePolicy string) error {
+	if code != 0 && !slices.Contains(RedirectCodes, code) {
+		return fmt.Errorf("%w: %d", ErrBadRedirectCode, code)
+	}
+	if cachePolicy == "" {
+		return nil
+	}
+	for _, directive := range strings.Split(cachePolicy, ",") {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(directive), "=")
+		needValue, ok := cacheDirectives[strings.ToLower(name)]
+		if !ok || needValue != hasValue {
+			return fmt.Errorf("%w: %q", ErrBadCachePolicy, directive)
+		}
+		if n, err := strconv.Atoi(value); hasValue && (err != nil || n < 0) {
+			return fmt.Errorf("%w: %q", ErrBadCachePolicy, directive)
+		}
+	}
+	return nil
+}
+
+// Redirect Код перенаправления и заголовок Cache-Control ссылки с учетом настроек сервера
+func (d *URLData) Redirect() (int, string) {
+	code, cachePolicy := d.RedirectCode, d.CachePolicy
+	if code == 0 {
+		code = config.Options.RedirectCode
+	}
+	if code == 0 {
+		code = http.StatusTemporaryRedirect
+	}
+	if cachePolicy == "" {
+		cachePolicy = config.Options.RedirectCachePolicy
+	}
+	return code, cachePolicy
+}
@@ -0,0 +1,221 @@
+// Package storage реализует правила выбора адреса назначения при переходе
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/geoip"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRules Наибольшее количество правил у ссылки
+const maxRules = 20
+
+// Устройства в условиях правил
+const (
+	DeviceIOS     = "ios"
+	DeviceAndroid = "android"
+	DeviceMobile  = "mobile"
+	DeviceDesktop = "desktop"
+)
+
+// Devices Допустимые устройства в условиях правил
+var Devices = []string{DeviceIOS, DeviceAndroid, DeviceMobile, DeviceDesktop}
+
+// countryCode Код страны в правиле
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ErrBadRule Недопустимое правило ссылки
+var ErrBadRule = errors.New("недопустимое правило")
+
+// Rule Правило перехода: если выполнены все заданные условия, переход ведет на Target.
+// Незаданное условие выполняется всегда
+type Rule struct {
+	// Устройства клиента: ios, android, mobile, desktop
+	Device []string `json:"device,omitempty"`
+	// Языки из Accept-Language: "en" совпадает с "en-US", "en-US" - только с "en-US"
+	Language []string `json:"language,omitempty"`
+	// Страны клиента по базе GeoIP: коды ISO 3166-1 alpha-2 или EU для стран Европейского союза
+	Country []string `json:"country,omitempty"`
+	// Интервал действия правила
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	// Ежедневные часы действия "09:00-18:00", интервал может переходить через полночь
+	Hours string `json:"hours,omitempty"`
+	// Часовой пояс для Hours, по умолчанию UTC
+	Timezone string `json:"timezone,omitempty"`
+	// Адрес назначения
+	Target string `json:"target"`
+}
+
+// Visit Параметры перехода по ссылке, по которым выбирается адрес назначения
+type Visit struct {
+	UserAgent      string
+	AcceptLanguage string
+	Country        geoip.Country
+	Time           time.Time
+	// Вариант A/B теста, закрепленный за посетителем
+	Variant string
+}
+
+// Target Адрес назначения перехода и выбранный вариант.
+// Первое подходящее правило, иначе вариант A/B теста, иначе оригинальная ссылка
+func (d *URLData) Target(v Visit) (string, string) {
+	if len(d.Rules) > 0 {
+		device := deviceOf(v.UserAgent)
+		lang := preferredLanguage(v.AcceptLanguage)
+		for _, rule := range d.Rules {
+			if rule.match(device, lang, v.Country, v.Time) {
+				return rule.Target, ""
+			}
+		}
+	}
+	if variant := chooseVariant(d.Variants, v.Variant); variant != nil {
+		return variant.Target, variant.Name
+	}
+	return d.OriginalURL, ""
+}
+
+// ValidateRules Проверка правил ссылки. Адреса назначения приводятся к каноническому виду
+func ValidateRules(rules []Rule) error {
+	if len(rules) > maxRules {
+		return fmt.Errorf("%w: правил больше %d", ErrBadRule, maxRules)
+	}
+	for i := range rules {
+		rule := &rules[i]
+		target, err := urlnorm.Normalize(rule.Target)
+		if err != nil {
+			return fmt.Errorf("%w %d: %v", ErrBadRule, i, err)
+		}
+		rule.Target = target
+		if len(rule.Device) == 0 && len(rule.Language) == 0 && len(rule.Country) == 0 && rule.From == nil && rule.To == nil && rule.Hours == "" {
+			return fmt.Errorf("%w %d: нет условий", ErrBadRule, i)
+		}
+		for _, device := range rule.Device {
+			if !slices.Contains(Devices, device) {
+				return fmt.Errorf("%w %d: неизвестное устройство %q", ErrBadRule, i, device)
+			}
+		}
+		for j, code := range rule.Country {
+			code = strings.ToUpper(strings.TrimSpace(code))
+			if !countryCode.MatchString(code) {
+				return fmt.Errorf("%w %d: неверный код страны %q", ErrBadRule, i, rule.Country[j])
+			}
+			rule.Country[j] = code
+		}
+		if rule.From != nil && rule.To != nil && !rule.From.Before(*rule.To) {
+			return fmt.Errorf("%w %d: from позже to", ErrBadRule, i)
+		}
+		if rule.Hours != "" {
+			if _, _, err = parseHours(rule.Hours); err != nil {
+				return fmt.Errorf("%w %d: %v", ErrBadRule, i, err)
+			}
+		}
+		if _, err = time.LoadLocation(rule.Timezone); err != nil {
+			return fmt.Errorf("%w %d: %v", ErrBadRule, i, err)
+		}
+	}
+	return nil
+}
+
+// match Выполнены ли условия правила
+func (r *Rule) match(device []string, lang string, country geoip.Country, now time.Time) bool {
+	if len(r.Device) > 0 && !slices.ContainsFunc(r.Device, func(d string) bool { return slices.Contains(device, d) }) {
+		return false
+	}
+	if len(r.Language) > 0 && !slices.ContainsFunc(r.Language, func(l string) bool { return languageMatch(l, lang) }) {
+		return false
+	}
+	if len(r.Country) > 0 && !slices.ContainsFunc(r.Country, country.Match) {
+		return false
+	}
+	if r.From != nil && now.Before(*r.From) {
+		return false
+	}
+	if r.To != nil && !now.Before(*r.To) {
+		return false
+	}
+	if r.Hours != "" {
+		start, end, err := parseHours(r.Hours)
+		if err != nil {
+			return false
+		}
+		loc, err := time.LoadLocation(r.Timezone)
+		if err != nil {
+			return false
+		}
+		local := now.In(loc)
+		m := local.Hour()*60 + local.Minute()
+		if start <= end && (m < start || m >= end) {
+			return false
+		}
+		if start > end && m < start && m >= end {
+			return false
+		}
+	}
+	return true
+}
+
+// deviceOf Устройства, к которым относится клиент с заголовком User-Agent
+func deviceOf(userAgent string) []string {
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return []string{DeviceIOS, DeviceMobile}
+	case strings.Contains(userAgent, "Android"):
+		return []string{DeviceAndroid, DeviceMobile}
+	case strings.Contains(userAgent, "Mobile"):
+		return []string{DeviceMobile}
+	}
+	return []string{DeviceDesktop}
+}
+
+// preferredLanguage Язык с наибольшим весом из заголовка Accept-Language
+func preferredLanguage(header string) string {
+	var lang string
+	best := 0.0
+	for _, item := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if tag != "" && tag != "*" && q > best {
+			lang, best = tag, q
+		}
+	}
+	return lang
+}
+
+// languageMatch Совпадает ли язык клиента с языком правила
+func languageMatch(rule, lang string) bool {
+	if strings.EqualFold(rule, lang) {
+		return true
+	}
+	primary, _, _ := strings.Cut(lang, "-")
+	return !strings.Contains(rule, "-") && strings.EqualFold(rule, primary)
+}
+
+// parseHours Разбор ежедневных часов "HH:MM-HH:MM" в минуты от начала суток
+func parseHours(hours string) (int, int, error) {
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("часы %q: ожидается HH:MM-HH:MM", hours)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, fmt.Errorf("часы %q: %w", hours, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return 0, 0, fmt.Errorf("часы %q: %w", hours, err)
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/geoip"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Target(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)
+	data := &URLData{
+		OriginalURL: "https://example.com/",
+		Rules: []Rule{
+			{Device: []string{DeviceIOS}, Target: "https://apps.apple.com/app"},
+			{Device: []string{DeviceAndroid}, Target: "https://play.google.com/app"},
+			{Country: []string{"GB"}, Target: "https://example.co.uk/"},
+			{Country: []string{geoip.EU}, Target: "https://example.com/gdpr"},
+			{Language: []string{"ru"}, Target: "https://example.com/ru"},
+			{From: &from, To: &to, Target: "https://example.com/sale"},
+			{Hours: "22:00-06:00", Timezone: "Europe/Moscow", Target: "https://example.com/night"},
+		},
+	}
+	noon := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		visit  Visit
+		target string
+	}{
+		{"iphone", Visit{UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", Time: noon}, "https://apps.apple.com/app"},
+		{"android", Visit{UserAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) Mobile", Time: noon}, "https://play.google.com/app"},
+		{"russian", Visit{UserAgent: "Mozilla/5.0 (X11; Linux x86_64)", AcceptLanguage: "ru-RU,ru;q=0.9,en;q=0.8", Time: noon}, "https://example.com/ru"},
+		{"english preferred", Visit{AcceptLanguage: "en-US,ru;q=0.5", Time: noon}, "https://example.com/"},
+		{"eu visitor", Visit{Country: geoip.Country{ISOCode: "DE", EU: true}, Time: noon}, "https://example.com/gdpr"},
+		{"uk visitor", Visit{Country: geoip.Country{ISOCode: "GB"}, Time: noon}, "https://example.co.uk/"},
+		{"us visitor", Visit{Country: geoip.Country{ISOCode: "US"}, Time: noon}, "https://example.com/"},
+		{"sale week", Visit{Time: from.Add(12 * time.Hour)}, "https://example.com/sale"},
+		{"sale ended", Visit{Time: to.Add(12 * time.Hour)}, "https://example.com/"},
+		{"night in moscow", Visit{Time: time.Date(2024, 2, 1, 20, 0, 0, 0, time.UTC)}, "https://example.com/night"},
+		{"fallback", Visit{UserAgent: "curl/8.0", Time: noon}, "https://example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := data.Target(tt.visit); !assert.Equal(t, tt.target, got) {
+				panic(fmt.Errorf("target expect %v actual %v", tt.target, got))
+			}
+		})
+	}
+}
+
+func Test_ValidateRules(t *testing.T) {
+	from := time.Now()
+	to := from.Add(-time.Hour)
+	tests := []struct {
+		name    string
+		rules   []Rule
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"device", []Rule{{Device: []string{DeviceMobile}, Target: "HTTPS://Example.com:443/m"}}, false},
+		{"no conditions", []Rule{{Target: "https://example.com/"}}, true},
+		{"bad target", []Rule{{Device: []string{DeviceIOS}, Target: "javascript:alert(1)"}}, true},
+		{"unknown device", []Rule{{Device: []string{"tv"}, Target: "https://example.com/"}}, true},
+		{"country", []Rule{{Country: []string{"de", "EU"}, Target: "https://example.com/"}}, false},
+		{"bad country", []Rule{{Country: []string{"Germany"}, Target: "https://example.com/"}}, true},
+		{"bad interval", []Rule{{From: &from, To: &to, Target: "https://example.com/"}}, true},
+		{"bad hours", []Rule{{Hours: "9-18", Target: "https://example.com/"}}, true},
+		{"bad timezone", []Rule{{Hours: "09:00-18:00", Timezone: "Mars/Base", Target: "https://example.com/"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRules(tt.rules)
+			if !assert.Equal(t, tt.wantErr, err != nil) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+		})
+	}
+	// адрес назначения приводится к каноническому виду
+	rules := []Rule{{Device: []string{DeviceMobile}, Target: "HTTPS://Example.com:443/m"}}
+	assert.NoError(t, ValidateRules(rules))
+	assert.Equal(t, "https://example.com/m", rules[0].Target)
+	// коды стран приводятся к верхнему регистру
+	rules = []Rule{{Country: []string{"de"}, Target: "https://example.com/"}}
+	assert.NoError(t, ValidateRules(rules))
+	assert.Equal(t, []string{"DE"}, rules[0].Country)
+}
@@ -0,0 +1,66 @@
+// Package storage реализует окно активности ссылки
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
+	"time"
+)
+
+// ErrBadSchedule Недопустимое окно активности ссылки
+var ErrBadSchedule = errors.New("недопустимое окно активности")
+
+// Phase Состояние ссылки относительно окна активности
+type Phase int
+
+const (
+	// PhaseActive Ссылка действует
+	PhaseActive Phase = iota
+	// PhasePending Ссылка еще не активирована
+	PhasePending
+	// PhaseEnded Окно активности ссылки закончилось
+	PhaseEnded
+)
+
+// Phase Состояние ссылки на момент now. Окно включает NotBefore и не включает NotAfter
+func (d *URLData) Phase(now time.Time) Phase {
+	if d.NotBefore != nil && now.Before(*d.NotBefore) {
+		return PhasePending
+	}
+	if d.NotAfter != nil && !now.Before(*d.NotAfter) {
+		return PhaseEnded
+	}
+	return PhaseActive
+}
+
+// Scheduled У ссылки задано окно активности
+func (d *URLData) Scheduled() bool {
+	return d.NotBefore != nil || d.NotAfter != nil
+}
+
+// Fallback Запасной адрес ссылки в состоянии phase. Если у ссылки его нет,
+// после окончания окна используется запасной адрес сервера
+func (d *URLData) Fallback(phase Phase) string {
+	if d.FallbackURL == "" && phase == PhaseEnded {
+		return config.Options.FallbackURL
+	}
+	return d.FallbackURL
+}
+
+// ValidateSchedule Проверка окна активности ссылки. Запасной адрес приводится к каноническому виду
+func ValidateSchedule(d *URLData) error {
+	if d.NotBefore != nil && d.NotAfter != nil && !d.NotBefore.Before(*d.NotAfter) {
+		return fmt.Errorf("%w: not_before не раньше not_after", ErrBadSchedule)
+	}
+	if d.FallbackURL == "" {
+		return nil
+	}
+	fallback, err := urlnorm.Normalize(d.FallbackURL)
+	if err != nil {
+		return fmt.Errorf("%w: запасной адрес: %v", ErrBadSchedule, err)
+	}
+	d.FallbackURL = fallback
+	return nil
+}
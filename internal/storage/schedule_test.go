@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Phase(t *testing.T) {
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	tests := []struct {
+		name string
+		data URLData
+		now  time.Time
+		want Phase
+	}{
+		{"no window", URLData{}, start, PhaseActive},
+		{"before start", URLData{NotBefore: &start}, start.Add(-time.Second), PhasePending},
+		{"at start", URLData{NotBefore: &start, NotAfter: &end}, start, PhaseActive},
+		{"inside", URLData{NotBefore: &start, NotAfter: &end}, start.Add(time.Hour), PhaseActive},
+		{"at end", URLData{NotBefore: &start, NotAfter: &end}, end, PhaseEnded},
+		{"only end", URLData{NotAfter: &end}, end.Add(time.Hour), PhaseEnded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.data.Phase(tt.now); !assert.Equal(t, tt.want, got) {
+				panic(fmt.Errorf("phase expect %v actual %v", tt.want, got))
+			}
+		})
+	}
+}
+
+func Test_ValidateSchedule(t *testing.T) {
+	start := time.Now()
+	end := start.Add(time.Hour)
+	tests := []struct {
+		name    string
+		data    URLData
+		wantErr bool
+	}{
+		{"empty", URLData{}, false},
+		{"window", URLData{NotBefore: &start, NotAfter: &end, FallbackURL: "https://example.com/soon"}, false},
+		{"reversed window", URLData{NotBefore: &end, NotAfter: &start}, true},
+		{"empty window", URLData{NotBefore: &start, NotAfter: &start}, true},
+		{"bad fallback", URLData{NotAfter: &end, FallbackURL: "javascript:alert(1)"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSchedule(&tt.data)
+			if !assert.Equal(t, tt.wantErr, err != nil) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+		})
+	}
+	// запасной адрес приводится к каноническому виду
+	data := &URLData{FallbackURL: "HTTPS://Example.com:443/soon"}
+	assert.NoError(t, ValidateSchedule(data))
+	assert.Equal(t, "https://example.com/soon", data.FallbackURL)
+}
+
+func Test_Fallback(t *testing.T) {
+	config.Options.FallbackURL = "https://example.com/expired"
+	defer func() { config.Options.FallbackURL = "" }()
+	assert.Equal(t, "", (&URLData{}).Fallback(PhasePending))
+	assert.Equal(t, "https://example.com/expired", (&URLData{}).Fallback(PhaseEnded))
+	assert.Equal(t, "https://example.com/own", (&URLData{FallbackURL: "https://example.com/own"}).Fallback(PhaseEnded))
+}
@@ -2,8 +2,11 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/internal/metrics"
+	"time"
 )
 
 // ErrDataConflict Ошибка конфликта дубликата данных
@@ -11,14 +14,31 @@ var ErrDataConflict = errors.New("дубликат данных")
 
 // Storage Инткрфейс хранилища
 type Storage interface {
-	Get(shortURL string) (*URLData, error)
-	Post(data *URLData) error
-	PostBatch(urls []*URLData) error
-	FindByOriginalURL(originalURL string) (*URLData, error)
-	Ping() error
+	Get(ctx context.Context, shortURL string) (*URLData, error)
+	Post(ctx context.Context, data *URLData) error
+	PostBatch(ctx context.Context, urls []*URLData) error
+	FindByOriginalURL(ctx context.Context, originalURL string) (*URLData, error)
+	Ping(ctx context.Context) error
 	Close() error
-	GetUserURL(userID string) ([]*URLData, error)
-	DeleteUserURL(urls []*URLData) error
+	GetUserURL(ctx context.Context, userID string) ([]*URLData, error)
+	DeleteUserURL(ctx context.Context, urls []*URLData) error
+	Stats(ctx context.Context) (*Stats, error)
+	TransferUserURL(ctx context.Context, fromUserID, toUserID string) (int, error)
+	CountUserURL(ctx context.Context, userID string) (int, error)
+	UpdateUserURL(ctx context.Context, data *URLData) error
+	AddClick(ctx context.Context, click *Click) error
+	ClickStats(ctx context.Context, shortURL string) (*ClickStats, error)
+	// ConsumeClick Атомарное списание перехода по ссылке с ограничением, возвращает остаток.
+	// Для ссылки без ограничения, отсутствующей или без оставшихся переходов - ErrClicksExhausted
+	ConsumeClick(ctx context.Context, shortURL string) (int, error)
+}
+
+// Stats Статистика хранилища
+type Stats struct {
+	// Количество неудаленных ссылок
+	URLs int `json:"urls"`
+	// Количество пользователей, создававших ссылки
+	Users int `json:"users"`
 }
 
 // Stor Глобальная переменная для работы с хранилищем ссылок
@@ -32,15 +52,76 @@ type URLData struct {
 	OriginalURL string `json:"original_url,omitempty" db:"originalURL"`
 	UserID      string `json:"user_id,omitempty" db:"userID"`
 	DeletedFlag bool   `json:"-" db:"is_deleted"`
+	// Код перенаправления, 0 - по умолчанию сервера
+	RedirectCode int `json:"redirect_code,omitempty" db:"redirect_code"`
+	// Значение Cache-Control при перенаправлении, пусто - по умолчанию сервера
+	CachePolicy string `json:"cache_policy,omitempty" db:"cache_policy"`
+	// Присоединять к адресу назначения путь и параметры запроса перехода
+	Passthrough bool `json:"passthrough,omitempty" db:"passthrough"`
+	// Правила выбора адреса назначения, проверяются по порядку
+	Rules []Rule `json:"rules,omitempty" db:"rules"`
+	// Варианты адреса назначения для A/B теста
+	Variants []Variant `json:"variants,omitempty" db:"variants"`
+	// Хэш bcrypt пароля ссылки, пусто - ссылка без пароля
+	PasswordHash string `json:"password_hash,omitempty" db:"password_hash"`
+	// Допустимое количество переходов, 0 - без ограничения
+	MaxClicks int `json:"max_clicks,omitempty" db:"max_clicks"`
+	// Оставшееся количество переходов по ссылке с ограничением
+	RemainingClicks int `json:"remaining_clicks,omitempty" db:"remaining_clicks"`
+	// Начало и конец окна активности ссылки
+	NotBefore *time.Time `json:"not_before,omitempty" db:"not_before"`
+	NotAfter  *time.Time `json:"not_after,omitempty" db:"not_after"`
+	// Запасной адрес вне окна активности
+	FallbackURL string `json:"fallback_url,omitempty" db:"fallback_url"`
+	// Переход только по подписанной ссылке с действующим сроком
+	RequireSignature bool `json:"require_signature,omitempty" db:"require_signature"`
+	// Ссылка защищена паролем, заполняется в ответах вместо хэша
+	Protected bool `json:"protected,omitempty" db:"-"`
+	// Ошибка сохранения элемента пакета, например превышение квоты
+	Error string `json:"error,omitempty" db:"-"`
+	// Переходы по ссылке в хранилище в памяти
+	clicks ClickStats
 }
 
 // NewStorage создание нового хранилища
 func NewStorage() (Storage, error) {
 	if config.Options.DatabaseDSN != "" {
-		return NewPostgreWorker(config.Options.DatabaseDSN)
+		pgw, err := NewPostgreWorker(config.Options.DatabaseDSN)
+		if err != nil {
+			return nil, err
+		}
+		metrics.SetPgPoolStat(pgw.pool.Stat)
+		return NewInstrumentedStorage(pgw, "postgres"), nil
 	}
 	if config.Options.FileStoragePath != "" {
-		return NewFileWorker(config.Options.FileStoragePath)
+		fw, err := NewFileWorker(config.Options.FileStoragePath)
+		if err != nil {
+			return nil, err
+		}
+		return NewInstrumentedStorage(fw, "file"), nil
+	}
+	m, err := NewMemWorker()
+	if err != nil {
+		return nil, err
+	}
+	return NewInstrumentedStorage(m, "memory"), nil
+}
+
+// applySettings Перенос изменяемых настроек ссылки
+func (d *URLData) applySettings(from *URLData) {
+	d.RedirectCode = from.RedirectCode
+	d.CachePolicy = from.CachePolicy
+	d.Passthrough = from.Passthrough
+	d.Rules = from.Rules
+	d.Variants = from.Variants
+	d.PasswordHash = from.PasswordHash
+	d.NotBefore = from.NotBefore
+	d.NotAfter = from.NotAfter
+	d.FallbackURL = from.FallbackURL
+	d.RequireSignature = from.RequireSignature
+	// остаток переходов сбрасывается только при смене ограничения,
+	// иначе изменение других настроек затерло бы списанные переходы
+	if d.MaxClicks != from.MaxClicks {
+		d.SetMaxClicks(from.MaxClicks)
 	}
-	return NewMemWorker()
 }
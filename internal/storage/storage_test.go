@@ -1,9 +1,13 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/brianvoe/gofakeit"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -32,7 +36,7 @@ var urls = []*struct {
 }
 
 func getShortURL(Store Storage, originalURL string) string {
-	data, err := Store.FindByOriginalURL(originalURL)
+	data, err := Store.FindByOriginalURL(context.Background(), originalURL)
 	if err != nil {
 		panic(err)
 	}
@@ -40,13 +44,13 @@ func getShortURL(Store Storage, originalURL string) string {
 }
 
 func getURLData() *URLData {
-	return &URLData{"", urls[0].CorrelationID, urls[0].ShortURL, urls[0].OriginalURL, gofakeit.UUID(), false}
+	return &URLData{CorrID: urls[0].CorrelationID, ShortURL: urls[0].ShortURL, OriginalURL: urls[0].OriginalURL, UserID: gofakeit.UUID()}
 }
 
 func getURLDataBatch() []*URLData {
 	batch := []*URLData{}
 	for _, url := range urls {
-		batch = append(batch, &URLData{"", url.CorrelationID, url.ShortURL, url.OriginalURL, gofakeit.UUID(), false})
+		batch = append(batch, &URLData{CorrID: url.CorrelationID, ShortURL: url.ShortURL, OriginalURL: url.OriginalURL, UserID: gofakeit.UUID()})
 	}
 	return batch
 }
@@ -83,6 +87,36 @@ func Test_Storage(t *testing.T) {
 			"GetUserURL",
 			[]reflect.Value{reflect.ValueOf(gofakeit.UUID())},
 		},
+		{
+			"stats storage",
+			"Stats",
+			[]reflect.Value{},
+		},
+		{
+			"transfer user urls storage",
+			"TransferUserURL",
+			[]reflect.Value{reflect.ValueOf(gofakeit.UUID()), reflect.ValueOf(gofakeit.UUID())},
+		},
+		{
+			"count user urls storage",
+			"CountUserURL",
+			[]reflect.Value{reflect.ValueOf(gofakeit.UUID())},
+		},
+		{
+			"update user url storage",
+			"UpdateUserURL",
+			[]reflect.Value{reflect.ValueOf(getURLData())},
+		},
+		{
+			"click stats storage",
+			"ClickStats",
+			[]reflect.Value{reflect.ValueOf(gofakeit.UUID())},
+		},
+		{
+			"consume click storage",
+			"ConsumeClick",
+			[]reflect.Value{reflect.ValueOf(gofakeit.UUID())},
+		},
 		{
 			"close storage",
 			"Close",
@@ -128,12 +162,16 @@ func Test_Storage(t *testing.T) {
 				if tt.method == "Get" {
 					tt.in = []reflect.Value{reflect.ValueOf(getShortURL(Stor, urls[0].OriginalURL))}
 				}
-				res := reflect.ValueOf(Stor).MethodByName(tt.method).Call(tt.in)
+				in := tt.in
+				if tt.method != "Close" {
+					in = append([]reflect.Value{reflect.ValueOf(context.Background())}, tt.in...)
+				}
+				res := reflect.ValueOf(Stor).MethodByName(tt.method).Call(in)
 				var i int
 				for i = 0; i < len(res); i++ {
 					if res[i].Type().Name() == "error" && res[i].Interface() != nil {
 						err = res[i].Interface().(error)
-						if err != nil && !errors.Is(err, ErrDataConflict) {
+						if err != nil && !errors.Is(err, ErrDataConflict) && !errors.Is(err, ErrURLNotFound) && !errors.Is(err, ErrClicksExhausted) {
 							panic(fmt.Errorf("storage: %s method:  %s. failed to method call: %w", storname, tt.method, err))
 						}
 					}
@@ -144,3 +182,297 @@ func Test_Storage(t *testing.T) {
 		}
 	}
 }
+
+func Test_TransferUserURL(t *testing.T) {
+	mem, err := NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	file, err := NewFileWorker(filepath.Join(t.TempDir(), "urls.json"))
+	if err != nil {
+		panic(err)
+	}
+	tests := []struct {
+		name string
+		stor Storage
+	}{
+		{"map", mem},
+		{"file", file},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			anon, owner := gofakeit.UUID(), gofakeit.UUID()
+			for i := 0; i < 2; i++ {
+				err := tt.stor.Post(ctx, &URLData{OriginalURL: gofakeit.URL(), UserID: anon})
+				if err != nil {
+					panic(err)
+				}
+			}
+
+			n, err := tt.stor.TransferUserURL(ctx, anon, owner)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, n)
+
+			// повторная передача ничего не меняет
+			n, err = tt.stor.TransferUserURL(ctx, anon, owner)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, n)
+
+			urls, err := tt.stor.GetUserURL(ctx, owner)
+			assert.NoError(t, err)
+			assert.Len(t, urls, 2)
+			urls, err = tt.stor.GetUserURL(ctx, anon)
+			assert.NoError(t, err)
+			assert.Len(t, urls, 0)
+
+			// после перезаписи файла хранилище продолжает принимать ссылки
+			assert.NoError(t, tt.stor.Post(ctx, &URLData{OriginalURL: gofakeit.URL(), UserID: owner}))
+			urls, err = tt.stor.GetUserURL(ctx, owner)
+			assert.NoError(t, err)
+			assert.Len(t, urls, 3)
+
+			// адрес, уже сокращенный пользователем, не дублируется и остается у анонимного пользователя
+			dup := &URLData{OriginalURL: urls[0].OriginalURL, UserID: anon}
+			assert.NoError(t, tt.stor.Post(ctx, dup))
+			assert.NoError(t, tt.stor.Post(ctx, &URLData{OriginalURL: gofakeit.URL(), UserID: anon}))
+			n, err = tt.stor.TransferUserURL(ctx, anon, owner)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+			urls, err = tt.stor.GetUserURL(ctx, owner)
+			assert.NoError(t, err)
+			assert.Len(t, urls, 4)
+			urls, err = tt.stor.GetUserURL(ctx, anon)
+			assert.NoError(t, err)
+			if assert.Len(t, urls, 1) {
+				assert.Equal(t, dup.ShortURL, urls[0].ShortURL)
+			}
+			assert.NoError(t, tt.stor.Close())
+		})
+	}
+}
+
+func Test_UserQuota(t *testing.T) {
+	config.Options.UserQuota = 2
+	defer func() {
+		config.Options.UserQuota = 0
+		QuotaOverrides = map[string]int{}
+	}()
+	mem, err := NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	file, err := NewFileWorker(filepath.Join(t.TempDir(), "urls.json"))
+	if err != nil {
+		panic(err)
+	}
+	tests := []struct {
+		name string
+		stor Storage
+	}{
+		{"map", mem},
+		{"file", file},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			userID, vip := gofakeit.UUID(), gofakeit.UUID()
+			QuotaOverrides = map[string]int{vip: 0}
+
+			first := &URLData{OriginalURL: gofakeit.URL(), UserID: userID}
+			assert.NoError(t, tt.stor.Post(ctx, first))
+			batch := []*URLData{
+				{CorrID: "1", OriginalURL: gofakeit.URL(), UserID: userID},
+				{CorrID: "2", OriginalURL: gofakeit.URL(), UserID: userID},
+			}
+			err := tt.stor.PostBatch(ctx, batch)
+			assert.ErrorIs(t, err, ErrQuotaExceeded)
+			assert.Empty(t, batch[0].Error)
+			assert.NotEmpty(t, batch[0].ShortURL)
+			assert.Equal(t, ErrQuotaExceeded.Error(), batch[1].Error)
+			assert.Empty(t, batch[1].ShortURL)
+
+			// повтор существующей ссылки квоту не расходует
+			assert.ErrorIs(t, tt.stor.Post(ctx, &URLData{OriginalURL: first.OriginalURL, UserID: userID}), ErrDataConflict)
+			assert.ErrorIs(t, tt.stor.Post(ctx, &URLData{OriginalURL: gofakeit.URL(), UserID: userID}), ErrQuotaExceeded)
+
+			n, err := tt.stor.CountUserURL(ctx, userID)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, n)
+
+			// удаленная ссылка освобождает квоту
+			assert.NoError(t, tt.stor.DeleteUserURL(ctx, []*URLData{{ShortURL: first.ShortURL, UserID: userID}}))
+			n, err = tt.stor.CountUserURL(ctx, userID)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+			deleted, err := tt.stor.Get(ctx, first.ShortURL)
+			assert.NoError(t, err)
+			assert.True(t, deleted.DeletedFlag)
+			assert.NoError(t, tt.stor.Post(ctx, &URLData{OriginalURL: gofakeit.URL(), UserID: userID}))
+
+			// индивидуальная квота 0 снимает ограничение
+			for i := 0; i < 3; i++ {
+				assert.NoError(t, tt.stor.Post(ctx, &URLData{OriginalURL: gofakeit.URL(), UserID: vip}))
+			}
+
+			// повтор ссылки внутри пакета видит уже записанные ссылки пакета
+			same := gofakeit.URL()
+			batch = []*URLData{
+				{CorrID: "1", OriginalURL: same, UserID: vip},
+				{CorrID: "2", OriginalURL: same, UserID: vip},
+			}
+			assert.ErrorIs(t, tt.stor.PostBatch(ctx, batch), ErrDataConflict)
+			assert.Equal(t, batch[0].ShortURL, batch[1].ShortURL)
+			assert.NoError(t, tt.stor.Close())
+		})
+	}
+}
+
+func Test_ParseQuotaOverrides(t *testing.T) {
+	got, err := ParseQuotaOverrides([]string{"alice=10", " bob = 0"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"alice": 10, "bob": 0}, got)
+	_, err = ParseQuotaOverrides([]string{"alice"})
+	assert.Error(t, err)
+	_, err = ParseQuotaOverrides([]string{"alice=-1"})
+	assert.Error(t, err)
+}
+
+func Test_FindByOriginalURLCanonical(t *testing.T) {
+	ctx := context.Background()
+	stor, err := NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	data := &URLData{OriginalURL: "https://example.com/a", UserID: gofakeit.UUID()}
+	assert.NoError(t, stor.Post(ctx, data))
+
+	// другая запись того же адреса тем же пользователем считается дубликатом
+	dup := &URLData{OriginalURL: "HTTPS://Example.com:443/a", UserID: data.UserID}
+	assert.ErrorIs(t, stor.Post(ctx, dup), ErrDataConflict)
+	assert.Equal(t, data.ShortURL, dup.ShortURL)
+
+	// другой пользователь получает собственную короткую ссылку
+	other := &URLData{OriginalURL: "HTTPS://Example.com:443/a", UserID: gofakeit.UUID()}
+	assert.NoError(t, stor.Post(ctx, other))
+	assert.NotEqual(t, data.ShortURL, other.ShortURL)
+}
+
+func Test_PostOtherUser(t *testing.T) {
+	file, err := NewFileWorker(filepath.Join(t.TempDir(), "urls.json"))
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	ctx := context.Background()
+	data := &URLData{OriginalURL: "https://example.com/a", UserID: gofakeit.UUID()}
+	assert.NoError(t, file.Post(ctx, data))
+	assert.ErrorIs(t, file.Post(ctx, &URLData{OriginalURL: data.OriginalURL, UserID: data.UserID}), ErrDataConflict)
+
+	// ссылка другого пользователя не возвращается как дубликат
+	other := &URLData{OriginalURL: data.OriginalURL, UserID: gofakeit.UUID()}
+	assert.NoError(t, file.Post(ctx, other))
+	assert.NotEqual(t, data.ShortURL, other.ShortURL)
+}
+
+func Test_ValidateRedirect(t *testing.T) {
+	tests := []struct {
+		name        string
+		code        int
+		cachePolicy string
+		wantErr     error
+	}{
+		{"defaults", 0, "", nil},
+		{"permanent", 308, "public, max-age=86400", nil},
+		{"tracked", 302, "no-store", nil},
+		{"bad code", 200, "", ErrBadRedirectCode},
+		{"unknown directive", 301, "no-transform", ErrBadCachePolicy},
+		{"max-age without value", 301, "max-age", ErrBadCachePolicy},
+		{"negative max-age", 301, "max-age=-1", ErrBadCachePolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRedirect(tt.code, tt.cachePolicy)
+			if !assert.ErrorIs(t, err, tt.wantErr) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+		})
+	}
+}
+
+func Test_UpdateUserURL(t *testing.T) {
+	mem, err := NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	file, err := NewFileWorker(filepath.Join(t.TempDir(), "urls.json"))
+	if err != nil {
+		panic(err)
+	}
+	tests := []struct {
+		name string
+		stor Storage
+	}{
+		{"map", mem},
+		{"file", file},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			data := &URLData{OriginalURL: gofakeit.URL(), UserID: gofakeit.UUID()}
+			assert.NoError(t, tt.stor.Post(ctx, data))
+
+			// чужую ссылку изменить нельзя
+			other := *data
+			other.UserID = gofakeit.UUID()
+			assert.ErrorIs(t, tt.stor.UpdateUserURL(ctx, &other), ErrURLNotFound)
+
+			data.RedirectCode, data.CachePolicy = 301, "public"
+			assert.NoError(t, tt.stor.UpdateUserURL(ctx, data))
+			got, err := tt.stor.Get(ctx, data.ShortURL)
+			assert.NoError(t, err)
+			assert.Equal(t, 301, got.RedirectCode)
+			assert.Equal(t, "public", got.CachePolicy)
+			assert.Equal(t, data.OriginalURL, got.OriginalURL)
+			assert.NoError(t, tt.stor.Close())
+		})
+	}
+}
+
+func Test_FileGetSettings(t *testing.T) {
+	file, err := NewFileWorker(filepath.Join(t.TempDir(), "urls.json"))
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	ctx := context.Background()
+	userID := gofakeit.UUID()
+	protected := &URLData{OriginalURL: "https://example.com/secret", UserID: userID, RedirectCode: 301, CachePolicy: "public",
+		Passthrough: true, RequireSignature: true, FallbackURL: "https://example.com/soon"}
+	protected.SetMaxClicks(3)
+	if err = protected.SetPassword("secret"); err != nil {
+		panic(err)
+	}
+	plain := &URLData{OriginalURL: "https://example.com/plain", UserID: userID}
+	assert.NoError(t, file.Post(ctx, protected))
+	assert.NoError(t, file.Post(ctx, plain))
+
+	// настройки предыдущей записи не переходят на следующую
+	got, err := file.Get(ctx, plain.ShortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, plain.OriginalURL, got.OriginalURL)
+	assert.Zero(t, got.RedirectCode)
+	assert.Empty(t, got.CachePolicy)
+	assert.False(t, got.Passthrough)
+	assert.Empty(t, got.PasswordHash)
+	assert.Zero(t, got.MaxClicks)
+	assert.Zero(t, got.RemainingClicks)
+	assert.False(t, got.RequireSignature)
+	assert.Empty(t, got.FallbackURL)
+
+	got, err = file.Get(ctx, protected.ShortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, protected.PasswordHash, got.PasswordHash)
+	assert.Equal(t, 3, got.RemainingClicks)
+	assert.True(t, got.RequireSignature)
+}
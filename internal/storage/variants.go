@@ -0,0 +1,87 @@
+// Package storage реализует распределение переходов между вариантами ссылки
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/urlnorm"
+	"math/rand"
+	"regexp"
+)
+
+// maxVariants Наибольшее количество вариантов у ссылки
+const maxVariants = 10
+
+// ErrBadVariant Недопустимый вариант ссылки
+var ErrBadVariant = errors.New("недопустимый вариант")
+
+// variantName Допустимое имя варианта, оно же значение закрепляющей куки
+var variantName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Variant Вариант адреса назначения для A/B теста
+type Variant struct {
+	// Имя варианта, которым помечаются переходы
+	Name string `json:"name"`
+	// Адрес назначения
+	Target string `json:"target"`
+	// Доля трафика относительно остальных вариантов. 0 - новые посетители вариант не получают
+	Weight int `json:"weight"`
+}
+
+// ValidateVariants Проверка вариантов ссылки. Адреса назначения приводятся к каноническому виду
+func ValidateVariants(variants []Variant) error {
+	if len(variants) > maxVariants {
+		return fmt.Errorf("%w: вариантов больше %d", ErrBadVariant, maxVariants)
+	}
+	names := map[string]bool{}
+	var total int
+	for i := range variants {
+		variant := &variants[i]
+		if !variantName.MatchString(variant.Name) {
+			return fmt.Errorf("%w %d: имя %q", ErrBadVariant, i, variant.Name)
+		}
+		if names[variant.Name] {
+			return fmt.Errorf("%w %d: имя %q повторяется", ErrBadVariant, i, variant.Name)
+		}
+		names[variant.Name] = true
+		if variant.Weight < 0 {
+			return fmt.Errorf("%w %d: отрицательный вес", ErrBadVariant, i)
+		}
+		total += variant.Weight
+		target, err := urlnorm.Normalize(variant.Target)
+		if err != nil {
+			return fmt.Errorf("%w %d: %v", ErrBadVariant, i, err)
+		}
+		variant.Target = target
+	}
+	if len(variants) > 0 && total == 0 {
+		return fmt.Errorf("%w: сумма весов равна 0", ErrBadVariant)
+	}
+	return nil
+}
+
+// chooseVariant Выбор варианта: закрепленный за посетителем, иначе случайный по весам
+func chooseVariant(variants []Variant, sticky string) *Variant {
+	var total int
+	for i := range variants {
+		if variants[i].Name == sticky {
+			return &variants[i]
+		}
+		total += variants[i].Weight
+	}
+	if total == 0 {
+		return nil
+	}
+	return pickVariant(variants, rand.Intn(total))
+}
+
+// pickVariant Вариант, в долю которого попадает n из [0, сумма весов)
+func pickVariant(variants []Variant, n int) *Variant {
+	for i := range variants {
+		if n < variants[i].Weight {
+			return &variants[i]
+		}
+		n -= variants[i].Weight
+	}
+	return nil
+}
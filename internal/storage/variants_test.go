@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_ValidateVariants(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []Variant
+		wantErr  bool
+	}{
+		{"empty", nil, false},
+		{"two variants", []Variant{{"a", "https://example.com/a", 70}, {"b", "https://example.com/b", 30}}, false},
+		{"paused variant", []Variant{{"a", "https://example.com/a", 1}, {"b", "https://example.com/b", 0}}, false},
+		{"all paused", []Variant{{"a", "https://example.com/a", 0}}, true},
+		{"negative weight", []Variant{{"a", "https://example.com/a", -1}}, true},
+		{"duplicate name", []Variant{{"a", "https://example.com/a", 1}, {"a", "https://example.com/b", 1}}, true},
+		{"bad name", []Variant{{"a b", "https://example.com/a", 1}}, true},
+		{"bad target", []Variant{{"a", "ftp://example.com/a", 1}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateVariants(tt.variants)
+			if !assert.Equal(t, tt.wantErr, err != nil) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+		})
+	}
+}
+
+func Test_ChooseVariant(t *testing.T) {
+	variants := []Variant{{"a", "https://example.com/a", 3}, {"b", "https://example.com/b", 1}, {"c", "https://example.com/c", 0}}
+	// доли весов: 0-2 - a, 3 - b
+	assert.Equal(t, "a", pickVariant(variants, 0).Name)
+	assert.Equal(t, "a", pickVariant(variants, 2).Name)
+	assert.Equal(t, "b", pickVariant(variants, 3).Name)
+	// закрепленный вариант сохраняется, даже если новым посетителям не выдается
+	assert.Equal(t, "c", chooseVariant(variants, "c").Name)
+	// неизвестный закрепленный вариант выбирается заново
+	assert.Contains(t, []string{"a", "b"}, chooseVariant(variants, "gone").Name)
+	assert.Nil(t, chooseVariant(nil, ""))
+}
+
+func Test_ClickStats(t *testing.T) {
+	mem, err := NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	file, err := NewFileWorker(filepath.Join(t.TempDir(), "urls.json"))
+	if err != nil {
+		panic(err)
+	}
+	tests := []struct {
+		name string
+		stor Storage
+	}{
+		{"map", mem},
+		{"file", file},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			data := &URLData{OriginalURL: gofakeit.URL(), UserID: gofakeit.UUID()}
+			other := &URLData{OriginalURL: gofakeit.URL(), UserID: gofakeit.UUID()}
+			assert.NoError(t, tt.stor.Post(ctx, data))
+			assert.NoError(t, tt.stor.Post(ctx, other))
+			for _, click := range []Click{{Variant: "a", Country: "DE"}, {Variant: "a"}, {Variant: "b", Country: "DE"}, {Country: "US"}} {
+				click.ShortURL, click.Time = data.ShortURL, time.Now()
+				assert.NoError(t, tt.stor.AddClick(ctx, &click))
+			}
+			assert.NoError(t, tt.stor.AddClick(ctx, &Click{ShortURL: other.ShortURL, Time: time.Now()}))
+
+			stats, err := tt.stor.ClickStats(ctx, data.ShortURL)
+			assert.NoError(t, err)
+			assert.Equal(t, &ClickStats{Clicks: 4, Variants: map[string]int{"a": 2, "b": 1}, Countries: map[string]int{"DE": 2, "US": 1}}, stats)
+			stats, err = tt.stor.ClickStats(ctx, other.ShortURL)
+			assert.NoError(t, err)
+			assert.Equal(t, &ClickStats{Clicks: 1}, stats)
+			assert.NoError(t, tt.stor.Close())
+		})
+	}
+}
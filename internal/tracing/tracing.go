@@ -0,0 +1,97 @@
+// Package tracing реализует распределенную трассировку запросов через OpenTelemetry
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+)
+
+// instrumentationName Имя библиотеки инструментирования
+const instrumentationName = "github.com/gerasimovpavel/shortener.git"
+
+// Tracer Возвращает трассировщик сервиса
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Init Настройка провайдера трассировок по конфигурации.
+// Возвращает функцию для сброса буферов и остановки экспортера
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	// W3C traceparent/tracestate пробрасываем всегда, даже без экспорта
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	exporter, closer, err := newExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("shortener"),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+// newExporter Создание экспортера трассировок
+func newExporter(ctx context.Context) (sdktrace.SpanExporter, *os.File, error) {
+	switch config.Options.TraceExporter {
+	case "", "none":
+		return nil, nil, nil
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exp, nil, err
+	case "file":
+		f, err := os.OpenFile(config.Options.TraceFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, nil, err
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return exp, f, nil
+	case "otlp":
+		exp, err := otlptracehttp.New(ctx,
+			otlptracehttp.WithEndpoint(config.Options.TraceOTLPEndpoint),
+			otlptracehttp.WithInsecure(),
+		)
+		return exp, nil, err
+	default:
+		return nil, nil, fmt.Errorf("неизвестный экспортер трассировок: %s", config.Options.TraceExporter)
+	}
+}
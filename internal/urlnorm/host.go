@@ -0,0 +1,71 @@
+// Package urlnorm реализует разбор IP-адреса хоста в записях, которые понимают браузеры
+package urlnorm
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// HostIP IP-адрес хоста. Кроме обычной записи IPv4 принимаются числовая, шестнадцатеричная,
+// восьмеричная и сокращенная записи (2130706433, 0x7f000001, 0177.0.0.1, 127.1), как в inet_aton.
+// nil без ошибки, если хост является именем. Хост с числовой последней меткой, который не является
+// адресом, отклоняется с ErrInvalidURL
+func HostIP(host string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+	parts := strings.Split(strings.TrimSuffix(host, "."), ".")
+	if !numeric(parts[len(parts)-1]) {
+		return nil, nil
+	}
+	if len(parts) > 4 {
+		return nil, fmt.Errorf("%w: неверный адрес %q", ErrInvalidURL, host)
+	}
+	var addr uint64
+	for i, part := range parts {
+		n, err := ipv4Part(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: неверный адрес %q", ErrInvalidURL, host)
+		}
+		// последняя часть занимает все оставшиеся байты адреса
+		if i == len(parts)-1 {
+			if n >= 1<<(8*(4-i)) {
+				return nil, fmt.Errorf("%w: неверный адрес %q", ErrInvalidURL, host)
+			}
+			addr |= n
+			break
+		}
+		if n > 255 {
+			return nil, fmt.Errorf("%w: неверный адрес %q", ErrInvalidURL, host)
+		}
+		addr |= n << (8 * (3 - i))
+	}
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr)), nil
+}
+
+// numeric Похожа ли метка хоста на число
+func numeric(label string) bool {
+	if label == "" {
+		return false
+	}
+	if hex, ok := strings.CutPrefix(strings.ToLower(label), "0x"); ok {
+		return strings.Trim(hex, "0123456789abcdef") == ""
+	}
+	return strings.Trim(label, "0123456789") == ""
+}
+
+// ipv4Part Значение части адреса IPv4: 0x - шестнадцатеричное, ведущий 0 - восьмеричное
+func ipv4Part(part string) (uint64, error) {
+	switch {
+	case len(part) >= 2 && strings.EqualFold(part[:2], "0x"):
+		if part == "0x" || part == "0X" {
+			return 0, nil
+		}
+		return strconv.ParseUint(part[2:], 16, 32)
+	case len(part) > 1 && part[0] == '0':
+		return strconv.ParseUint(part[1:], 8, 32)
+	}
+	return strconv.ParseUint(part, 10, 32)
+}
@@ -0,0 +1,55 @@
+// Package urlnorm реализует присоединение пути и параметров запроса к ссылке
+package urlnorm
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Join Присоединение к адресу назначения target пути rest и параметров запроса rawQuery.
+// rest передается в экранированном виде, сегменты "." и ".." запрещены, чтобы не выйти за раздел сайта.
+// Параметры адреса назначения имеют приоритет: одноименные параметры запроса отбрасываются,
+// остальные добавляются в исходном порядке
+func Join(target, rest, rawQuery string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if rest != "" {
+		for _, segment := range strings.Split(rest, "/") {
+			s, err := url.PathUnescape(segment)
+			if err != nil {
+				return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+			}
+			if s == "." || s == ".." || strings.ContainsAny(s, "/\\") {
+				return "", fmt.Errorf("%w: недопустимый сегмент пути %q", ErrInvalidURL, segment)
+			}
+		}
+		escaped := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + rest
+		u.Path, err = url.PathUnescape(escaped)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+		}
+		u.RawPath = escaped
+	}
+
+	if rawQuery != "" {
+		fixed := u.Query()
+		pairs := []string{}
+		if u.RawQuery != "" {
+			pairs = append(pairs, u.RawQuery)
+		}
+		for _, pair := range strings.Split(rawQuery, "&") {
+			key, _, _ := strings.Cut(pair, "=")
+			if key, err = url.QueryUnescape(key); err != nil || key == "" {
+				continue
+			}
+			if _, ok := fixed[key]; !ok {
+				pairs = append(pairs, pair)
+			}
+		}
+		u.RawQuery = strings.Join(pairs, "&")
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,41 @@
+package urlnorm
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Join(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		rest     string
+		rawQuery string
+		want     string
+		wantErr  bool
+	}{
+		{"nothing to join", "https://example.com/docs", "", "", "https://example.com/docs", false},
+		{"path", "https://example.com/docs", "guide/page", "", "https://example.com/docs/guide/page", false},
+		{"trailing slash", "https://example.com/docs/", "page/", "", "https://example.com/docs/page/", false},
+		{"root", "https://example.com", "page", "", "https://example.com/page", false},
+		{"escaped segment", "https://example.com/docs", "a%20b", "", "https://example.com/docs/a%20b", false},
+		{"query appended", "https://example.com/docs", "page", "x=1", "https://example.com/docs/page?x=1", false},
+		{"target query wins", "https://example.com/?utm=site&a=1", "", "utm=evil&b=2&a=3", "https://example.com/?utm=site&a=1&b=2", false},
+		{"fragment kept", "https://example.com/docs#top", "page", "x=1", "https://example.com/docs/page?x=1#top", false},
+		{"dot dot", "https://example.com/docs", "../admin", "", "", true},
+		{"encoded dot dot", "https://example.com/docs", "%2e%2E/admin", "", "", true},
+		{"encoded slash", "https://example.com/docs", "a%2Fb", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Join(tt.target, tt.rest, tt.rawQuery)
+			if !assert.Equal(t, tt.wantErr, err != nil) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
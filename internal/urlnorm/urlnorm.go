@@ -0,0 +1,93 @@
+// Package urlnorm Проверка и приведение ссылок к каноническому виду
+package urlnorm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidURL Ссылка не является абсолютным адресом с разрешенной схемой
+var ErrInvalidURL = errors.New("неверная ссылка")
+
+// defaultSchemes Разрешенные схемы, если в конфигурации не заданы
+var defaultSchemes = []string{"http", "https"}
+
+// defaultPorts Порты по умолчанию, которые убираются из адреса
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Normalize Проверка ссылки и приведение ее к каноническому виду:
+// схема и хост в нижнем регистре, IDN в punycode, IPv4 в обычной записи, без порта по умолчанию,
+// параметры запроса сортируются, если включено в конфигурации
+func Normalize(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if !slices.Contains(schemes(), u.Scheme) {
+		return "", fmt.Errorf("%w: схема %q не разрешена", ErrInvalidURL, u.Scheme)
+	}
+	if u.Opaque != "" || u.Hostname() == "" {
+		return "", fmt.Errorf("%w: нужен абсолютный адрес", ErrInvalidURL)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) == nil {
+		// числовые записи IPv4 приводятся к обычной, чтобы проверка подсетей видела адрес
+		ip, err := HostIP(host)
+		if err != nil {
+			return "", err
+		}
+		if ip != nil {
+			host = ip.String()
+		} else if host, err = idna.Lookup.ToASCII(host); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+		}
+	}
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		// IPv6 без порта
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	if config.Options.URLSortQuery && u.RawQuery != "" {
+		// Encode сортирует параметры по имени
+		u.RawQuery = u.Query().Encode()
+	}
+	return u.String(), nil
+}
+
+// Canonical Канонический вид ссылки для сравнения.
+// Ссылка, которую нельзя привести, возвращается как есть
+func Canonical(raw string) string {
+	norm, err := Normalize(raw)
+	if err != nil {
+		return raw
+	}
+	return norm
+}
+
+// schemes Разрешенные схемы ссылок
+func schemes() []string {
+	if len(config.Options.URLSchemes) == 0 {
+		return defaultSchemes
+	}
+	return config.Options.URLSchemes
+}
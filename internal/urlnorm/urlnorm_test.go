@@ -0,0 +1,53 @@
+package urlnorm
+
+import (
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Normalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		sortQuery bool
+		want      string
+		wantErr   bool
+	}{
+		{"already canonical", "https://example.com/a?b=1", false, "https://example.com/a?b=1", false},
+		{"case and spaces", "  HTTP://Example.COM/Path ", false, "http://example.com/Path", false},
+		{"default port", "https://example.com:443/", false, "https://example.com/", false},
+		{"other port", "http://example.com:8080/", false, "http://example.com:8080/", false},
+		{"idn", "http://пример.рф/путь", false, "http://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C", false},
+		{"ipv6", "http://[::1]:80/", false, "http://[::1]/", false},
+		{"ipv4 decimal", "http://2130706433/", false, "http://127.0.0.1/", false},
+		{"ipv4 hex", "http://0x7F000001:8080/", false, "http://127.0.0.1:8080/", false},
+		{"ipv4 short", "http://127.1/", false, "http://127.0.0.1/", false},
+		{"ipv4 octal", "http://0177.0.0.01/", false, "http://127.0.0.1/", false},
+		{"ipv4 out of range", "http://256.0.0.1/", false, "", true},
+		{"ipv4 too many parts", "http://1.2.3.4.5/", false, "", true},
+		{"numeric subdomain", "http://8.example.com/", false, "http://8.example.com/", false},
+		{"query kept", "http://example.com/?b=2&a=1", false, "http://example.com/?b=2&a=1", false},
+		{"query sorted", "http://example.com/?b=2&a=1", true, "http://example.com/?a=1&b=2", false},
+		{"empty", "   ", false, "", true},
+		{"relative", "/path/to", false, "", true},
+		{"javascript", "javascript:alert(1)", false, "", true},
+		{"ftp", "ftp://example.com/file", false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Options.URLSortQuery = tt.sortQuery
+			defer func() { config.Options.URLSortQuery = false }()
+			got, err := Normalize(tt.in)
+			if !assert.Equal(t, tt.wantErr, err != nil) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+// Package users реализует API-ключи пользователей для программных клиентов
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix Префикс API-ключа, по нему ключ отличается от токена в заголовке Authorization
+const APIKeyPrefix = "shk_"
+
+// Области действия API-ключа
+const (
+	// ScopeRead Чтение ссылок пользователя
+	ScopeRead = "read"
+	// ScopeShorten Создание коротких ссылок
+	ScopeShorten = "shorten"
+	// ScopeDelete Удаление ссылок пользователя
+	ScopeDelete = "delete"
+)
+
+// Scopes Все допустимые области действия
+var Scopes = []string{ScopeRead, ScopeShorten, ScopeDelete}
+
+var (
+	// ErrAPIKeyNotFound API-ключ не найден или отозван
+	ErrAPIKeyNotFound = errors.New("API-ключ не найден")
+	// ErrBadScope Неизвестная область действия ключа
+	ErrBadScope = errors.New("неизвестная область действия")
+)
+
+// APIKey API-ключ пользователя. Сам ключ не хранится, только его хэш
+type APIKey struct {
+	// ID ключа
+	ID string `json:"id" db:"id"`
+	// ID владельца
+	UserID string `json:"user_id" db:"user_id"`
+	// Название ключа
+	Name string `json:"name" db:"name"`
+	// SHA-256 ключа в hex
+	Hash string `json:"hash" db:"hash"`
+	// Области действия
+	Scopes []string `json:"scopes" db:"scopes"`
+	// Время создания
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	// Время отзыва, nil - ключ действует
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// NewAPIKey Создание ключа для пользователя userID. Возвращает ключ в открытом виде,
+// он показывается пользователю один раз
+func NewAPIKey(userID, name string, scopes []string) (string, *APIKey, error) {
+	if len(scopes) == 0 {
+		return "", nil, ErrBadScope
+	}
+	for _, s := range scopes {
+		if !validScope(s) {
+			return "", nil, ErrBadScope
+		}
+	}
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = rand.Read(secret)
+	if err != nil {
+		return "", nil, err
+	}
+	plain := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return plain, &APIKey{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Name:      name,
+		Hash:      HashAPIKey(plain),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// HashAPIKey Хэш ключа для хранения и поиска
+func HashAPIKey(plain string) string {
+	h := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(h[:])
+}
+
+// IsAPIKey Строка похожа на API-ключ
+func IsAPIKey(s string) bool {
+	return strings.HasPrefix(s, APIKeyPrefix)
+}
+
+// HasScope Ключ разрешает область действия scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// validScope Проверка области действия
+func validScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+// Package users реализует хранение пользователей в текстовом файле
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileWorker Хранилище пользователей в файле, по одному JSON объекту на строку.
+// API-ключи хранятся рядом, в файле с суффиксом .keys, отозванные токены - .revoked
+type FileWorker struct {
+	mu          sync.Mutex
+	filename    string
+	keysname    string
+	revokedname string
+}
+
+// revokedToken Запись об отозванном токене
+type revokedToken struct {
+	JTI       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewFileWorker Создание нового хранилища
+func NewFileWorker(filename string) (*FileWorker, error) {
+	fw := &FileWorker{filename: filename, keysname: filename + ".keys", revokedname: filename + ".revoked"}
+	for _, name := range []string{fw.filename, fw.keysname, fw.revokedname} {
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		err = file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fw, nil
+}
+
+// find Поиск пользователя в файле
+func (fw *FileWorker) find(login string) (*User, error) {
+	file, err := os.Open(fw.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	for {
+		u := User{}
+		err = decoder.Decode(&u)
+		if errors.Is(err, io.EOF) {
+			return nil, ErrUserNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if u.Login == login {
+			return &u, nil
+		}
+	}
+}
+
+// Create Регистрация пользователя
+func (fw *FileWorker) Create(_ context.Context, user *User) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	_, err := fw.find(user.Login)
+	if err == nil {
+		return ErrUserExists
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	file, err := os.OpenFile(fw.filename, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(file).Encode(user)
+	return errors.Join(err, file.Close())
+}
+
+// GetByLogin Поиск пользователя по логину
+func (fw *FileWorker) GetByLogin(_ context.Context, login string) (*User, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.find(login)
+}
+
+// readKeys Чтение всех API-ключей
+func (fw *FileWorker) readKeys() ([]APIKey, error) {
+	file, err := os.Open(fw.keysname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	keys := []APIKey{}
+	decoder := json.NewDecoder(file)
+	for {
+		key := APIKey{}
+		err = decoder.Decode(&key)
+		if errors.Is(err, io.EOF) {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+}
+
+// writeKeys Перезапись файла API-ключей через временный файл
+func (fw *FileWorker) writeKeys(keys []APIKey) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fw.keysname), filepath.Base(fw.keysname)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	encoder := json.NewEncoder(tmp)
+	for i := range keys {
+		err = encoder.Encode(&keys[i])
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	err = errors.Join(tmp.Sync(), tmp.Close())
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fw.keysname)
+}
+
+// CreateAPIKey Сохранение API-ключа
+func (fw *FileWorker) CreateAPIKey(_ context.Context, key *APIKey) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	file, err := os.OpenFile(fw.keysname, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(file).Encode(key)
+	return errors.Join(err, file.Close())
+}
+
+// ListAPIKeys Список API-ключей пользователя, включая отозванные
+func (fw *FileWorker) ListAPIKeys(_ context.Context, userID string) ([]*APIKey, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	all, err := fw.readKeys()
+	if err != nil {
+		return nil, err
+	}
+	keys := []*APIKey{}
+	for i := range all {
+		if all[i].UserID == userID {
+			keys = append(keys, &all[i])
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// RevokeAPIKey Отзыв API-ключа пользователя
+func (fw *FileWorker) RevokeAPIKey(_ context.Context, userID, id string) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	keys, err := fw.readKeys()
+	if err != nil {
+		return err
+	}
+	for i := range keys {
+		if keys[i].UserID == userID && keys[i].ID == id && keys[i].RevokedAt == nil {
+			now := time.Now().UTC()
+			keys[i].RevokedAt = &now
+			return fw.writeKeys(keys)
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// GetAPIKey Поиск действующего API-ключа по хэшу
+func (fw *FileWorker) GetAPIKey(_ context.Context, hash string) (*APIKey, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	keys, err := fw.readKeys()
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if keys[i].Hash == hash && keys[i].RevokedAt == nil {
+			return &keys[i], nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+// RevokeToken Отзыв токена до момента его истечения
+func (fw *FileWorker) RevokeToken(_ context.Context, jti string, expiresAt time.Time) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	file, err := os.OpenFile(fw.revokedname, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(file).Encode(&revokedToken{JTI: jti, ExpiresAt: expiresAt})
+	return errors.Join(err, file.Close())
+}
+
+// IsTokenRevoked Проверка отзыва токена
+func (fw *FileWorker) IsTokenRevoked(_ context.Context, jti string) (bool, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	file, err := os.Open(fw.revokedname)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	for {
+		rt := revokedToken{}
+		err = decoder.Decode(&rt)
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if rt.JTI == jti {
+			return true, nil
+		}
+	}
+}
+
+// Close Закрытие хранилища
+func (fw *FileWorker) Close() error {
+	return nil
+}
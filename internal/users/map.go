@@ -0,0 +1,121 @@
+// Package users реализует хранение пользователей в памяти
+package users
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemWorker Хранилище пользователей в памяти
+type MemWorker struct {
+	mu    sync.RWMutex
+	users map[string]User
+	keys  map[string]APIKey
+	// отозванные токены: jti - время истечения
+	revoked map[string]time.Time
+}
+
+// NewMemWorker Создание нового хранилища
+func NewMemWorker() (*MemWorker, error) {
+	return &MemWorker{users: map[string]User{}, keys: map[string]APIKey{}, revoked: map[string]time.Time{}}, nil
+}
+
+// Create Регистрация пользователя
+func (m *MemWorker) Create(_ context.Context, user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[user.Login]; ok {
+		return ErrUserExists
+	}
+	m.users[user.Login] = *user
+	return nil
+}
+
+// GetByLogin Поиск пользователя по логину
+func (m *MemWorker) GetByLogin(_ context.Context, login string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[login]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &u, nil
+}
+
+// CreateAPIKey Сохранение API-ключа
+func (m *MemWorker) CreateAPIKey(_ context.Context, key *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[key.Hash] = *key
+	return nil
+}
+
+// ListAPIKeys Список API-ключей пользователя, включая отозванные
+func (m *MemWorker) ListAPIKeys(_ context.Context, userID string) ([]*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := []*APIKey{}
+	for _, key := range m.keys {
+		if key.UserID == userID {
+			key := key
+			keys = append(keys, &key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// RevokeAPIKey Отзыв API-ключа пользователя
+func (m *MemWorker) RevokeAPIKey(_ context.Context, userID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for hash, key := range m.keys {
+		if key.UserID == userID && key.ID == id && key.RevokedAt == nil {
+			now := time.Now().UTC()
+			key.RevokedAt = &now
+			m.keys[hash] = key
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// GetAPIKey Поиск действующего API-ключа по хэшу
+func (m *MemWorker) GetAPIKey(_ context.Context, hash string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key, ok := m.keys[hash]
+	if !ok || key.RevokedAt != nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+// RevokeToken Отзыв токена до момента его истечения. Истекшие записи удаляются
+func (m *MemWorker) RevokeToken(_ context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for id, exp := range m.revoked {
+		if exp.Before(now) {
+			delete(m.revoked, id)
+		}
+	}
+	m.revoked[jti] = expiresAt
+	return nil
+}
+
+// IsTokenRevoked Проверка отзыва токена
+func (m *MemWorker) IsTokenRevoked(_ context.Context, jti string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.revoked[jti]
+	return ok, nil
+}
+
+// Close Закрытие хранилища
+func (m *MemWorker) Close() error {
+	return nil
+}
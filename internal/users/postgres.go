@@ -0,0 +1,182 @@
+// Package users реализует хранение пользователей в СУБД postgres
+package users
+
+import (
+	"context"
+	"errors"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/gerasimovpavel/shortener.git/internal/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// PgWorker Хранилище пользователей в СУБД Postgres
+type PgWorker struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgreWorker Создание нового хранилища
+func NewPostgreWorker(ps string) (*PgWorker, error) {
+	config, err := pgxpool.ParseConfig(ps)
+	if err != nil {
+		return nil, err
+	}
+	config.MaxConns = 10
+	config.ConnConfig.Tracer = tracing.PgxTracer{}
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = pool.Exec(context.Background(),
+		`CREATE TABLE IF NOT EXISTS public.users
+(
+    id text COLLATE pg_catalog."default" NOT NULL PRIMARY KEY,
+    login text COLLATE pg_catalog."default" NOT NULL UNIQUE,
+    password_hash text COLLATE pg_catalog."default" NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+)`,
+	)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	_, err = pool.Exec(context.Background(),
+		`CREATE TABLE IF NOT EXISTS public.api_keys
+(
+    id text COLLATE pg_catalog."default" NOT NULL PRIMARY KEY,
+    user_id text COLLATE pg_catalog."default" NOT NULL,
+    name text COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    hash text COLLATE pg_catalog."default" NOT NULL UNIQUE,
+    scopes text[] NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    revoked_at timestamptz
+)`,
+	)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	_, err = pool.Exec(context.Background(),
+		`CREATE TABLE IF NOT EXISTS public.revoked_tokens
+(
+    jti text COLLATE pg_catalog."default" NOT NULL PRIMARY KEY,
+    expires_at timestamptz NOT NULL
+)`,
+	)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &PgWorker{pool: pool}, nil
+}
+
+// Create Регистрация пользователя
+func (pgw *PgWorker) Create(ctx context.Context, user *User) error {
+	tag, err := pgw.pool.Exec(ctx,
+		`INSERT INTO users (id, login, password_hash, created_at)
+				VALUES ($1,$2,$3,$4)
+				ON CONFLICT (login) DO NOTHING`,
+		user.ID,
+		user.Login,
+		user.PasswordHash,
+		user.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserExists
+	}
+	return nil
+}
+
+// GetByLogin Поиск пользователя по логину
+func (pgw *PgWorker) GetByLogin(ctx context.Context, login string) (*User, error) {
+	u := &User{}
+	err := pgxscan.Get(ctx, pgw.pool, u, `SELECT id, login, password_hash, created_at FROM users WHERE login=$1`, login)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// CreateAPIKey Сохранение API-ключа
+func (pgw *PgWorker) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	_, err := pgw.pool.Exec(ctx,
+		`INSERT INTO api_keys (id, user_id, name, hash, scopes, created_at) VALUES ($1,$2,$3,$4,$5,$6)`,
+		key.ID,
+		key.UserID,
+		key.Name,
+		key.Hash,
+		key.Scopes,
+		key.CreatedAt,
+	)
+	return err
+}
+
+// ListAPIKeys Список API-ключей пользователя, включая отозванные
+func (pgw *PgWorker) ListAPIKeys(ctx context.Context, userID string) ([]*APIKey, error) {
+	keys := []*APIKey{}
+	err := pgxscan.Select(ctx, pgw.pool, &keys,
+		`SELECT id, user_id, name, hash, scopes, created_at, revoked_at FROM api_keys WHERE user_id=$1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey Отзыв API-ключа пользователя
+func (pgw *PgWorker) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	tag, err := pgw.pool.Exec(ctx,
+		`UPDATE api_keys SET revoked_at=now() WHERE user_id=$1 AND id=$2 AND revoked_at IS NULL`, userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// GetAPIKey Поиск действующего API-ключа по хэшу
+func (pgw *PgWorker) GetAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	key := &APIKey{}
+	err := pgxscan.Get(ctx, pgw.pool, key,
+		`SELECT id, user_id, name, hash, scopes, created_at, revoked_at FROM api_keys WHERE hash=$1 AND revoked_at IS NULL`, hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// RevokeToken Отзыв токена до момента его истечения. Истекшие записи удаляются
+func (pgw *PgWorker) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := pgw.pool.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < now()`)
+	if err != nil {
+		return err
+	}
+	_, err = pgw.pool.Exec(ctx,
+		`INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1,$2) ON CONFLICT (jti) DO NOTHING`, jti, expiresAt)
+	return err
+}
+
+// IsTokenRevoked Проверка отзыва токена
+func (pgw *PgWorker) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := pgw.pool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti=$1)`, jti).Scan(&revoked)
+	return revoked, err
+}
+
+// Close Закрытие хранилища
+func (pgw *PgWorker) Close() error {
+	pgw.pool.Close()
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package users реализует хранение зарегистрированных пользователей
+package users
+
+import (
+	"context"
+	"errors"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"golang.org/x/crypto/bcrypt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUserExists Пользователь с таким логином уже зарегистрирован
+	ErrUserExists = errors.New("пользователь уже существует")
+	// ErrUserNotFound Пользователь не найден
+	ErrUserNotFound = errors.New("пользователь не найден")
+	// ErrBadCredentials Неверный логин или пароль
+	ErrBadCredentials = errors.New("неверный логин или пароль")
+)
+
+// Storage Интерфейс хранилища пользователей
+type Storage interface {
+	Create(ctx context.Context, user *User) error
+	GetByLogin(ctx context.Context, login string) (*User, error)
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	ListAPIKeys(ctx context.Context, userID string) ([]*APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id string) error
+	GetAPIKey(ctx context.Context, hash string) (*APIKey, error)
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	Close() error
+}
+
+// Stor Глобальная переменная для работы с хранилищем пользователей
+var Stor Storage
+
+// User Зарегистрированный пользователь
+type User struct {
+	// ID пользователя, совпадает с UserID в токене и у ссылок
+	ID string `json:"id" db:"id"`
+	// Логин
+	Login string `json:"login" db:"login"`
+	// bcrypt-хэш пароля
+	PasswordHash string `json:"password_hash" db:"password_hash"`
+	// Время регистрации
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// NewUser Создание пользователя с хэшированием пароля
+func NewUser(id, login, password string) (*User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return &User{
+		ID:           id,
+		Login:        login,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// CheckPassword Проверка пароля пользователя
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// dummyHash Хэш, с которым сравнивается пароль неизвестного логина, чтобы время ответа не выдавало существующие логины
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// Authenticate Поиск пользователя по логину и проверка пароля.
+// Для неизвестного логина пароль тоже проверяется bcrypt, по фиксированному хэшу
+func Authenticate(ctx context.Context, s Storage, login, password string) (*User, error) {
+	u, err := s.GetByLogin(ctx, login)
+	if errors.Is(err, ErrUserNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, ErrBadCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !u.CheckPassword(password) {
+		return nil, ErrBadCredentials
+	}
+	return u, nil
+}
+
+// NewStorage Создание хранилища пользователей по конфигурации
+func NewStorage() (Storage, error) {
+	if config.Options.DatabaseDSN != "" {
+		return NewPostgreWorker(config.Options.DatabaseDSN)
+	}
+	if config.Options.UsersFileStoragePath != "" {
+		return NewFileWorker(config.Options.UsersFileStoragePath)
+	}
+	return NewMemWorker()
+}
@@ -0,0 +1,117 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Storage(t *testing.T) {
+	mem, err := NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	file, err := NewFileWorker(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		panic(err)
+	}
+
+	tests := []struct {
+		name string
+		stor Storage
+	}{
+		{"memory", mem},
+		{"file", file},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			u, err := NewUser("id-1", "alice", "secret")
+			if err != nil {
+				panic(err)
+			}
+			assert.NotEqual(t, "secret", u.PasswordHash)
+			assert.NoError(t, tt.stor.Create(ctx, u))
+
+			dup, _ := NewUser("id-2", "alice", "other")
+			err = tt.stor.Create(ctx, dup)
+			if !assert.True(t, errors.Is(err, ErrUserExists)) {
+				panic(fmt.Errorf("error expect %v actual %v", ErrUserExists, err))
+			}
+
+			found, err := Authenticate(ctx, tt.stor, "alice", "secret")
+			assert.NoError(t, err)
+			assert.Equal(t, "id-1", found.ID)
+
+			_, err = Authenticate(ctx, tt.stor, "alice", "wrong")
+			assert.ErrorIs(t, err, ErrBadCredentials)
+			_, err = Authenticate(ctx, tt.stor, "bob", "secret")
+			assert.ErrorIs(t, err, ErrBadCredentials)
+
+			plain, key, err := NewAPIKey("id-1", "ci", []string{ScopeShorten})
+			if err != nil {
+				panic(err)
+			}
+			assert.NotContains(t, key.Hash, plain)
+			assert.NoError(t, tt.stor.CreateAPIKey(ctx, key))
+			stored, err := tt.stor.GetAPIKey(ctx, HashAPIKey(plain))
+			assert.NoError(t, err)
+			assert.True(t, stored.HasScope(ScopeShorten))
+			assert.False(t, stored.HasScope(ScopeDelete))
+			assert.ErrorIs(t, tt.stor.RevokeAPIKey(ctx, "id-2", key.ID), ErrAPIKeyNotFound)
+			assert.NoError(t, tt.stor.RevokeAPIKey(ctx, "id-1", key.ID))
+			_, err = tt.stor.GetAPIKey(ctx, HashAPIKey(plain))
+			assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+			keys, err := tt.stor.ListAPIKeys(ctx, "id-1")
+			assert.NoError(t, err)
+			if assert.Len(t, keys, 1) {
+				assert.NotNil(t, keys[0].RevokedAt)
+			}
+			_, _, err = NewAPIKey("id-1", "bad", []string{"admin"})
+			assert.ErrorIs(t, err, ErrBadScope)
+
+			assert.NoError(t, tt.stor.RevokeToken(ctx, "jti-1", time.Now().Add(time.Hour)))
+			revoked, err := tt.stor.IsTokenRevoked(ctx, "jti-1")
+			assert.NoError(t, err)
+			assert.True(t, revoked)
+			revoked, err = tt.stor.IsTokenRevoked(ctx, "jti-2")
+			assert.NoError(t, err)
+			assert.False(t, revoked)
+			assert.NoError(t, tt.stor.Close())
+		})
+	}
+}
+
+func Test_AuthenticateUnknownLogin(t *testing.T) {
+	ctx := context.Background()
+	stor, err := NewMemWorker()
+	if err != nil {
+		panic(err)
+	}
+	u, err := NewUser("id-1", "alice", "secret")
+	if err != nil {
+		panic(err)
+	}
+	if err = stor.Create(ctx, u); err != nil {
+		panic(err)
+	}
+	cost, err := bcrypt.Cost(dummyHash())
+	assert.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+
+	// неизвестный логин проверяется так же долго, как неверный пароль
+	start := time.Now()
+	_, err = Authenticate(ctx, stor, "alice", "wrong")
+	known := time.Since(start)
+	assert.ErrorIs(t, err, ErrBadCredentials)
+	start = time.Now()
+	_, err = Authenticate(ctx, stor, "bob", "wrong")
+	unknown := time.Since(start)
+	assert.ErrorIs(t, err, ErrBadCredentials)
+	assert.Greater(t, unknown, known/2)
+}
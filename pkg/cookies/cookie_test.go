@@ -2,8 +2,12 @@ package cookies
 
 import (
 	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
 	"github.com/stretchr/testify/assert"
+	"net/http"
 	"testing"
+	"time"
 )
 
 func Test_Cookie(t *testing.T) {
@@ -32,3 +36,54 @@ func Test_Cookie(t *testing.T) {
 		})
 	}
 }
+
+func Test_CookieAttributes(t *testing.T) {
+	config.Options.TokenTTL = time.Hour
+	defer func() {
+		config.Options.CookieHTTPOnly = false
+		config.Options.CookieSecure = false
+		config.Options.CookieSameSite = ""
+		config.Options.CookieDomain = ""
+	}()
+	tests := []struct {
+		name       string
+		httpOnly   bool
+		secure     bool
+		sameSite   string
+		wantSite   http.SameSite
+		wantSecure bool
+	}{
+		{"defaults", true, false, "", http.SameSiteLaxMode, false},
+		{"strict secure", true, true, "strict", http.SameSiteStrictMode, true},
+		{"none forces secure", false, false, "none", http.SameSiteNoneMode, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Options.CookieHTTPOnly = tt.httpOnly
+			config.Options.CookieSecure = tt.secure
+			config.Options.CookieSameSite = tt.sameSite
+			config.Options.CookieDomain = "short.example"
+
+			cookie, err := NewCookie(nil)
+			if err != nil {
+				panic(err)
+			}
+			assert.Equal(t, tt.httpOnly, cookie.HttpOnly)
+			assert.Equal(t, tt.wantSecure, cookie.Secure)
+			assert.Equal(t, tt.wantSite, cookie.SameSite)
+			assert.Equal(t, "short.example", cookie.Domain)
+
+			// срок жизни куки совпадает со сроком действия токена
+			claims, err := crypt.ParseToken(cookie.Value)
+			if err != nil {
+				panic(err)
+			}
+			assert.True(t, claims.ExpiresAt.Time.Equal(cookie.Expires))
+
+			clear := ClearCookie()
+			assert.Equal(t, Name, clear.Name)
+			assert.Equal(t, -1, clear.MaxAge)
+			assert.Equal(t, tt.wantSite, clear.SameSite)
+		})
+	}
+}
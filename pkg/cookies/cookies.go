@@ -3,26 +3,77 @@ package cookies
 
 import (
 	"github.com/brianvoe/gofakeit"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
 	"github.com/gerasimovpavel/shortener.git/pkg/crypt"
 	"net/http"
-	"time"
+	"strings"
 )
 
-// NewCookie Создание куки с данными аутентификации
+// Name Имя куки авторизации
+const Name = "UserID"
+
+// NewCookie Создание куки с данными аутентификации нового анонимного пользователя
 func NewCookie(cookie *http.Cookie) (*http.Cookie, error) {
 	gofakeit.Seed(0)
-	if cookie == nil {
-		cookie = &http.Cookie{}
+	token, claims, err := crypt.BuildToken(gofakeit.UUID())
+	return fillCookie(cookie, token, claims, err)
+}
+
+// NewUserCookie Создание куки с токеном зарегистрированного пользователя userID
+func NewUserCookie(cookie *http.Cookie, userID string) (*http.Cookie, error) {
+	token, claims, err := crypt.BuildRegisteredToken(userID)
+	return fillCookie(cookie, token, claims, err)
+}
+
+// ReissueCookie Создание куки с перевыпущенным токеном пользователя
+func ReissueCookie(cookie *http.Cookie, claims *crypt.Claims) (*http.Cookie, error) {
+	token, claims, err := crypt.Reissue(claims)
+	return fillCookie(cookie, token, claims, err)
+}
+
+// ClearCookie Куки, удаляющая куку авторизации в браузере
+func ClearCookie() *http.Cookie {
+	cookie := &http.Cookie{}
+	setAttributes(cookie)
+	cookie.MaxAge = -1
+	return cookie
+}
+
+// sameSite Значение атрибута SameSite из конфигурации. По умолчанию Lax
+func sameSite() http.SameSite {
+	switch strings.ToLower(config.Options.CookieSameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
 	}
-	cookie.Name = "UserID"
-	cookie.Expires = time.Now().Add(time.Hour * 24)
+}
+
+// setAttributes Установка имени и атрибутов куки авторизации из конфигурации
+func setAttributes(cookie *http.Cookie) {
+	cookie.Name = Name
 	cookie.Path = "/"
+	cookie.Domain = config.Options.CookieDomain
+	cookie.HttpOnly = config.Options.CookieHTTPOnly
+	cookie.SameSite = sameSite()
+	// браузеры отбрасывают SameSite=None без Secure
+	cookie.Secure = config.Options.CookieSecure || cookie.SameSite == http.SameSiteNoneMode
+}
 
-	userIDEncrypted, err := crypt.Encrypt(gofakeit.UUID())
+// fillCookie Заполнение куки выпущенным токеном
+func fillCookie(cookie *http.Cookie, token string, claims *crypt.Claims, err error) (*http.Cookie, error) {
+	if cookie == nil {
+		cookie = &http.Cookie{}
+	}
+	setAttributes(cookie)
 	if err != nil {
 		cookie.Name = ""
 		return cookie, err
 	}
-	cookie.Value = userIDEncrypted
+	cookie.Value = token
+	// кука живет столько же, сколько токен
+	cookie.Expires = claims.ExpiresAt.Time
 	return cookie, nil
 }
@@ -1,56 +1,144 @@
-// Package crypt реализует шифрование/дешифрование ключей авторизации
+// Package crypt реализует выпуск и проверку подписанных токенов авторизации
 package crypt
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/sha256"
+	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+	"strings"
+	"time"
 )
 
-// Encrypt Шифрование ключа
-func Encrypt(src string) (string, error) {
-	key := sha256.Sum256([]byte(config.Options.PassphraseKey))
+// DefaultTokenTTL Время жизни токена, если в конфигурации оно не задано
+const DefaultTokenTTL = 24 * time.Hour
 
-	aesblock, err := aes.NewCipher(key[:])
-	if err != nil {
-		return "", err
+var (
+	// ErrTokenExpired Срок действия токена истек
+	ErrTokenExpired = errors.New("срок действия токена истек")
+	// ErrTokenInvalid Токен поврежден или подписан другим ключом
+	ErrTokenInvalid = errors.New("неверный токен")
+)
+
+// Claims Данные токена авторизации
+type Claims struct {
+	jwt.RegisteredClaims
+	// ID пользователя
+	UserID string `json:"user_id"`
+	// Пользователь зарегистрирован. Токены без признака выданы анонимным пользователям
+	Registered bool `json:"registered,omitempty"`
+	// ID ключа, которым подписан токен (заголовок kid)
+	KeyID string `json:"-"`
+	// Токен прежнего формата (AES-GCM), принимается только для перевыпуска
+	Legacy bool `json:"-"`
+}
+
+// Stale Токен подписан не активным ключом или выпущен в прежнем формате и его нужно перевыпустить
+func (c *Claims) Stale() bool {
+	if c.Legacy {
+		return true
 	}
-	aesgcm, err := cipher.NewGCM(aesblock)
+	id, _, err := activeKey()
 	if err != nil {
-		return "", err
+		return false
+	}
+	keyID := c.KeyID
+	if keyID == "" {
+		keyID = LegacyKeyID
 	}
+	return keyID != id
+}
 
-	nonce := key[len(key)-aesgcm.NonceSize():]
+// NeedsRefresh Токен нужно перевыпустить: он подписан не активным ключом
+// или до окончания его действия осталось меньше TokenRefreshBefore
+func (c *Claims) NeedsRefresh() bool {
+	if c.Stale() {
+		return true
+	}
+	before := config.Options.TokenRefreshBefore
+	return before > 0 && c.ExpiresAt != nil && time.Until(c.ExpiresAt.Time) < before
+}
 
-	enc := aesgcm.Seal(nil, nonce, []byte(src), nil)
-	dst := hex.EncodeToString(enc)
-	return dst, nil
+// tokenTTL Время жизни выпускаемых токенов
+func tokenTTL() time.Duration {
+	if config.Options.TokenTTL > 0 {
+		return config.Options.TokenTTL
+	}
+	return DefaultTokenTTL
 }
 
-// Decrypt Дешифрование ключа
-func Decrypt(src string) (string, error) {
-	key := sha256.Sum256([]byte(config.Options.PassphraseKey))
+// BuildToken Выпуск токена для анонимного пользователя userID
+func BuildToken(userID string) (string, *Claims, error) {
+	return buildToken(userID, false)
+}
 
-	aesblock, err := aes.NewCipher(key[:])
+// BuildRegisteredToken Выпуск токена для зарегистрированного пользователя userID
+func BuildRegisteredToken(userID string) (string, *Claims, error) {
+	return buildToken(userID, true)
+}
+
+// Reissue Перевыпуск токена активным ключом с сохранением данных пользователя
+func Reissue(c *Claims) (string, *Claims, error) {
+	return buildToken(c.UserID, c.Registered)
+}
+
+// buildToken Выпуск токена активным ключом
+func buildToken(userID string, registered bool) (string, *Claims, error) {
+	jti := make([]byte, 16)
+	_, err := rand.Read(jti)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	aesgcm, err := cipher.NewGCM(aesblock)
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(jti),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL())),
+		},
+		UserID:     userID,
+		Registered: registered,
+	}
+	keyID, secret, err := activeKey()
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-
-	nonce := key[len(key)-aesgcm.NonceSize():]
-
-	encrypted, err := hex.DecodeString(src)
+	claims.KeyID = keyID
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t.Header["kid"] = keyID
+	token, err := t.SignedString(secret)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// ParseToken Проверка подписи и срока действия токена.
+// Токен без точек считается токеном прежнего формата, см. parseLegacyToken
+func ParseToken(tokenString string) (*Claims, error) {
+	if tokenString != "" && !strings.Contains(tokenString, ".") {
+		return parseLegacyToken(tokenString)
+	}
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			claims.KeyID, _ = t.Header["kid"].(string)
+			return verifyKey(claims.KeyID)
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrTokenExpired
 	}
-	decrypted, err := aesgcm.Open(nil, nonce, encrypted, nil)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+	if claims.UserID == "" {
+		return nil, fmt.Errorf("%w: нет ID пользователя", ErrTokenInvalid)
 	}
-	return string(decrypted), nil
+	return claims, nil
 }
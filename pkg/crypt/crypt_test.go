@@ -1,43 +1,163 @@
 package crypt
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
-	"strings"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func Test_Crypt(t *testing.T) {
 	tests := []struct {
-		name   string
-		msg    string
-		result string
+		name    string
+		ttl     time.Duration
+		key     string
+		wantErr error
 	}{
-		{"test encrypt",
-			"Hello, world",
-			"32c5327350d9faaf6ce0dc50bd40ba2f85c6e2f8e846dfc804fefa85"},
-		{"test decrypt",
-			"32c5327350d9faaf6ce0dc50bd40ba2f85c6e2f8e846dfc804fefa85",
-			"Hello, world"},
+		{"test valid token",
+			time.Hour,
+			"LH;bjdsahlbhfu",
+			nil},
+		{"test expired token",
+			-time.Minute,
+			"LH;bjdsahlbhfu",
+			ErrTokenExpired},
+		{"test wrong key",
+			time.Hour,
+			"another key",
+			ErrTokenInvalid},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var res string
-			var err error
-
 			config.Options.PassphraseKey = "LH;bjdsahlbhfu"
+			config.Options.TokenTTL = tt.ttl
 
-			if strings.Contains(tt.name, "encrypt") {
-				res, err = Encrypt(tt.msg)
+			var token string
+			var err error
+			if tt.ttl > 0 {
+				var claims *Claims
+				token, claims, err = BuildToken("Hello, world")
+				assert.WithinDuration(t, time.Now().Add(tt.ttl), claims.ExpiresAt.Time, time.Second)
+			} else {
+				// токен, выпущенный в прошлом
+				token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+					RegisteredClaims: jwt.RegisteredClaims{
+						IssuedAt:  jwt.NewNumericDate(time.Now().Add(tt.ttl - time.Hour)),
+						ExpiresAt: jwt.NewNumericDate(time.Now().Add(tt.ttl)),
+					},
+					UserID: "Hello, world",
+				}).SignedString(legacySecret())
 			}
-			if strings.Contains(tt.name, "decrypt") {
-				res, err = Decrypt(tt.msg)
+			if err != nil {
+				panic(err)
 			}
 
-			if !assert.Equal(t, tt.result, res) {
-				panic(fmt.Errorf("status expect %v actual %v\n %w", tt.result, res, err))
+			config.Options.PassphraseKey = tt.key
+			parsed, err := ParseToken(token)
+			if !assert.True(t, errors.Is(err, tt.wantErr)) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+			if tt.wantErr == nil {
+				assert.Equal(t, "Hello, world", parsed.UserID)
+			}
+		})
+	}
+
+	_, err := ParseToken("32c5327350d9faaf6ce0dc50bd40ba2f85c6e2f8e846dfc804fefa85")
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
+
+func Test_EmptyPassphrase(t *testing.T) {
+	config.Options.PassphraseKey = ""
+	config.Options.TokenTTL = time.Hour
+	defer func() { config.Options.PassphraseKey = "LH;bjdsahlbhfu" }()
+
+	// без пароля токен, подписанный ключом из пустой строки, не принимается
+	empty := sha256.Sum256(nil)
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		UserID:           "victim",
+	}).SignedString(empty[:])
+	if err != nil {
+		panic(err)
+	}
+	_, err = ParseToken(forged)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	// как и подпись ссылки
+	exp := time.Now().Add(time.Hour).Unix()
+	sig := LegacyKeyID + "." + base64.RawURLEncoding.EncodeToString(urlMAC(empty[:], "abc", exp))
+	assert.ErrorIs(t, VerifyURL("abc", strconv.FormatInt(exp, 10), sig), ErrSignatureInvalid)
+
+	// токены, выпущенные случайным ключом процесса, принимаются
+	token, _, err := BuildToken("user")
+	if err != nil {
+		panic(err)
+	}
+	claims, err := ParseToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", claims.UserID)
+}
+
+// encryptLegacy Токен прежнего формата: AES-GCM с nonce из ключа
+func encryptLegacy(passphrase, userID string) string {
+	key := sha256.Sum256([]byte(passphrase))
+	aesblock, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err)
+	}
+	aesgcm, err := cipher.NewGCM(aesblock)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(aesgcm.Seal(nil, key[len(key)-aesgcm.NonceSize():], []byte(userID), nil))
+}
+
+func Test_LegacyToken(t *testing.T) {
+	defer func() { config.Options.PassphraseKey = "" }()
+	userID := "53be0840-8503-11ee-b9d1-0242ac120002"
+	tests := []struct {
+		name       string
+		passphrase string
+		token      string
+		wantErr    error
+	}{
+		{"valid", "legacy key", encryptLegacy("legacy key", userID), nil},
+		{"other key", "legacy key", encryptLegacy("other key", userID), ErrTokenInvalid},
+		{"tampered", "legacy key", "00" + encryptLegacy("legacy key", userID)[2:], ErrTokenInvalid},
+		{"not hex", "legacy key", "not-a-token", ErrTokenInvalid},
+		{"empty passphrase", "", encryptLegacy("", userID), ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Options.PassphraseKey = tt.passphrase
+			claims, err := ParseToken(tt.token)
+			if tt.wantErr != nil {
+				if !assert.ErrorIs(t, err, tt.wantErr) {
+					panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+				}
+				return
 			}
+			assert.NoError(t, err)
+			assert.Equal(t, userID, claims.UserID)
+			assert.False(t, claims.Registered)
+			assert.True(t, claims.NeedsRefresh())
+
+			// токен прежнего формата перевыпускается в JWT того же пользователя
+			token, _, err := Reissue(claims)
+			assert.NoError(t, err)
+			reissued, err := ParseToken(token)
+			assert.NoError(t, err)
+			assert.Equal(t, userID, reissued.UserID)
+			assert.False(t, reissued.NeedsRefresh())
 		})
 	}
 }
@@ -0,0 +1,211 @@
+// Package crypt реализует набор ключей подписи токенов с ротацией
+package crypt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"os"
+	"sync"
+	"time"
+)
+
+// LegacyKeyID ID ключа, получаемого из PassphraseKey.
+// Им проверяются токены без kid, выпущенные до появления набора ключей
+const LegacyKeyID = "default"
+
+// ErrKeyNotFound Ключ с указанным ID отсутствует в наборе
+var ErrKeyNotFound = errors.New("ключ не найден")
+
+// Key Ключ подписи
+type Key struct {
+	// ID ключа, записывается в заголовок kid токена
+	ID string `json:"id"`
+	// Секрет в base64
+	Secret string `json:"secret"`
+	// Время создания
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Keyring Набор ключей: один активный для подписи, остальные только для проверки
+type Keyring struct {
+	// ID активного ключа
+	Active string `json:"active"`
+	// Все ключи
+	Keys []Key `json:"keys"`
+}
+
+var (
+	ringMu sync.RWMutex
+	ring   *Keyring
+)
+
+// SetKeyring Установка набора ключей сервиса. nil - использовать ключ из PassphraseKey
+func SetKeyring(k *Keyring) {
+	ringMu.Lock()
+	defer ringMu.Unlock()
+	ring = k
+}
+
+// LoadKeyring Загрузка набора ключей сервиса из файла
+func LoadKeyring(path string) error {
+	k, err := ReadKeyring(path)
+	if err != nil {
+		return err
+	}
+	_, err = k.secret(k.Active)
+	if err != nil {
+		return fmt.Errorf("активный ключ %q: %w", k.Active, err)
+	}
+	SetKeyring(k)
+	return nil
+}
+
+// ReadKeyring Чтение набора ключей из файла. Отсутствующий файл - пустой набор
+func ReadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, k)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Save Запись набора ключей в файл
+func (k *Keyring) Save(path string) error {
+	b, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Generate Создание нового ключа. Ключ добавляется только для проверки, активировать его - Promote
+func (k *Keyring) Generate() (*Key, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	key := Key{
+		ID:        fmt.Sprintf("k%d", now.Unix()),
+		Secret:    base64.StdEncoding.EncodeToString(secret),
+		CreatedAt: now,
+	}
+	for _, existing := range k.Keys {
+		if existing.ID == key.ID {
+			key.ID = fmt.Sprintf("k%d", now.UnixNano())
+		}
+	}
+	k.Keys = append(k.Keys, key)
+	return &key, nil
+}
+
+// Promote Назначение ключа активным
+func (k *Keyring) Promote(id string) error {
+	_, err := k.secret(id)
+	if err != nil {
+		return err
+	}
+	k.Active = id
+	return nil
+}
+
+// Remove Удаление ключа. Активный ключ удалить нельзя
+func (k *Keyring) Remove(id string) error {
+	if id == k.Active {
+		return errors.New("нельзя удалить активный ключ")
+	}
+	for i, key := range k.Keys {
+		if key.ID == id {
+			k.Keys = append(k.Keys[:i], k.Keys[i+1:]...)
+			return nil
+		}
+	}
+	return ErrKeyNotFound
+}
+
+// secret Секрет ключа по ID
+func (k *Keyring) secret(id string) ([]byte, error) {
+	for _, key := range k.Keys {
+		if key.ID == id {
+			return base64.StdEncoding.DecodeString(key.Secret)
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// randomSecret Случайный ключ процесса. Ключ из пустого PassphraseKey общеизвестен,
+// поэтому без пароля токены и подписи ссылок действуют только до перезапуска
+var randomSecret = sync.OnceValue(func() []byte {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		panic(fmt.Errorf("не могу создать случайный ключ: %w", err))
+	}
+	return secret
+})
+
+// legacySecret Ключ, получаемый из PassphraseKey, без пароля - случайный ключ процесса
+func legacySecret() []byte {
+	if config.Options.PassphraseKey == "" {
+		return randomSecret()
+	}
+	key := sha256.Sum256([]byte(config.Options.PassphraseKey))
+	return key[:]
+}
+
+// activeKey Активный ключ подписи и его ID
+func activeKey() (string, []byte, error) {
+	ringMu.RLock()
+	k := ring
+	ringMu.RUnlock()
+	if k == nil || k.Active == "" {
+		return LegacyKeyID, legacySecret(), nil
+	}
+	secret, err := k.secret(k.Active)
+	if err != nil {
+		return "", nil, err
+	}
+	return k.Active, secret, nil
+}
+
+// verifyKey Ключ проверки по ID. Токены без ID и с LegacyKeyID
+// проверяются ключом из PassphraseKey, если в наборе нет ключа с таким ID
+func verifyKey(id string) ([]byte, error) {
+	if id == "" {
+		id = LegacyKeyID
+	}
+	ringMu.RLock()
+	k := ring
+	ringMu.RUnlock()
+	if k != nil {
+		secret, err := k.secret(id)
+		if err == nil {
+			return secret, nil
+		}
+	}
+	// без пароля ключ из PassphraseKey общеизвестен, поэтому при настроенном
+	// наборе ключей его принимаем только если пароль задан
+	if id == LegacyKeyID && (k == nil || k.Active == "" || config.Options.PassphraseKey != "") {
+		return legacySecret(), nil
+	}
+	return nil, ErrKeyNotFound
+}
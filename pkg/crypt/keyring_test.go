@@ -0,0 +1,86 @@
+package crypt
+
+import (
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_KeyringRotation(t *testing.T) {
+	config.Options.PassphraseKey = "LH;bjdsahlbhfu"
+	config.Options.TokenTTL = time.Hour
+	defer SetKeyring(nil)
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	k, err := ReadKeyring(path)
+	if err != nil {
+		panic(err)
+	}
+
+	// токен, выпущенный до появления набора ключей
+	legacy, _, err := BuildToken("user")
+	if err != nil {
+		panic(err)
+	}
+
+	first, err := k.Generate()
+	if err != nil {
+		panic(err)
+	}
+	assert.NoError(t, k.Promote(first.ID))
+	assert.NoError(t, k.Save(path))
+	assert.NoError(t, LoadKeyring(path))
+
+	old, claims, err := BuildToken("user")
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, first.ID, claims.KeyID)
+
+	second, err := k.Generate()
+	if err != nil {
+		panic(err)
+	}
+	assert.NoError(t, k.Promote(second.ID))
+	assert.NoError(t, k.Save(path))
+	assert.NoError(t, LoadKeyring(path))
+
+	tests := []struct {
+		name      string
+		token     string
+		wantErr   error
+		wantStale bool
+	}{
+		{"legacy token", legacy, nil, true},
+		{"token signed with retired key", old, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseToken(tt.token)
+			if !assert.ErrorIs(t, err, tt.wantErr) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+			assert.Equal(t, tt.wantStale, parsed.Stale())
+		})
+	}
+
+	fresh, claims, err := BuildToken("user")
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, second.ID, claims.KeyID)
+	parsed, err := ParseToken(fresh)
+	assert.NoError(t, err)
+	assert.False(t, parsed.Stale())
+
+	// активный ключ удалить нельзя, удаленный ключ больше не принимается
+	assert.Error(t, k.Remove(second.ID))
+	assert.NoError(t, k.Remove(first.ID))
+	assert.NoError(t, k.Save(path))
+	assert.NoError(t, LoadKeyring(path))
+	_, err = ParseToken(old)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
@@ -0,0 +1,43 @@
+// Package crypt реализует проверку токенов прежнего формата
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+)
+
+// parseLegacyToken Проверка токена прежнего формата: hex от AES-GCM шифра ID пользователя
+// ключом из PassphraseKey с nonce из того же ключа. Такие токены только проверяются и сразу
+// перевыпускаются в JWT, чтобы анонимные пользователи не потеряли ссылки при обновлении.
+// Без пароля ключ общеизвестен, поэтому токены не принимаются. Убрать в следующем выпуске
+func parseLegacyToken(token string) (*Claims, error) {
+	if config.Options.PassphraseKey == "" {
+		return nil, fmt.Errorf("%w: токен прежнего формата без пароля", ErrTokenInvalid)
+	}
+	encrypted, err := hex.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+	key := sha256.Sum256([]byte(config.Options.PassphraseKey))
+	aesblock, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aesgcm, err := cipher.NewGCM(aesblock)
+	if err != nil {
+		return nil, err
+	}
+	nonce := key[len(key)-aesgcm.NonceSize():]
+	userID, err := aesgcm.Open(nil, nonce, encrypted, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+	if len(userID) == 0 {
+		return nil, fmt.Errorf("%w: нет ID пользователя", ErrTokenInvalid)
+	}
+	return &Claims{UserID: string(userID), Legacy: true}, nil
+}
@@ -0,0 +1,65 @@
+// Package crypt реализует токены доступа к ссылкам, защищенным паролем
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"time"
+)
+
+// linkAudience Назначение токена доступа к ссылке, отличает его от токена авторизации
+const linkAudience = "link"
+
+// linkClaims Данные токена доступа к ссылке
+type linkClaims struct {
+	jwt.RegisteredClaims
+	// Отпечаток пароля ссылки на момент выпуска
+	Fingerprint string `json:"pwd"`
+}
+
+// BuildLinkToken Выпуск токена доступа к ссылке shortURL активным ключом на время ttl.
+// fingerprint - отпечаток пароля ссылки, после смены пароля токен перестает действовать
+func BuildLinkToken(shortURL, fingerprint string, ttl time.Duration) (string, error) {
+	keyID, secret, err := activeKey()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, &linkClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   shortURL,
+			Audience:  jwt.ClaimStrings{linkAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Fingerprint: fingerprint,
+	})
+	t.Header["kid"] = keyID
+	return t.SignedString(secret)
+}
+
+// ParseLinkToken Проверка токена доступа к ссылке shortURL с отпечатком пароля fingerprint
+func ParseLinkToken(tokenString, shortURL, fingerprint string) error {
+	claims := &linkClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			keyID, _ := t.Header["kid"].(string)
+			return verifyKey(keyID)
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(linkAudience),
+		jwt.WithSubject(shortURL),
+		jwt.WithExpirationRequired(),
+	)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return ErrTokenExpired
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+	if claims.Fingerprint != fingerprint {
+		return fmt.Errorf("%w: пароль ссылки изменен", ErrTokenInvalid)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_LinkToken(t *testing.T) {
+	config.Options.PassphraseKey = "link token key"
+	config.Options.TokenTTL = time.Hour
+
+	token, err := BuildLinkToken("abc", "fp1", time.Minute)
+	if err != nil {
+		panic(err)
+	}
+	expired, err := BuildLinkToken("abc", "fp1", -time.Minute)
+	if err != nil {
+		panic(err)
+	}
+	auth, _, err := BuildToken("user")
+	if err != nil {
+		panic(err)
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		shortURL    string
+		fingerprint string
+		wantErr     error
+	}{
+		{"valid", token, "abc", "fp1", nil},
+		{"other link", token, "xyz", "fp1", ErrTokenInvalid},
+		{"password changed", token, "abc", "fp2", ErrTokenInvalid},
+		{"expired", expired, "abc", "fp1", ErrTokenExpired},
+		{"auth token", auth, "abc", "fp1", ErrTokenInvalid},
+		{"garbage", "garbage", "abc", "fp1", ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ParseLinkToken(tt.token, tt.shortURL, tt.fingerprint)
+			if !assert.Equal(t, tt.wantErr == nil, err == nil) || !errors.Is(err, tt.wantErr) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+		})
+	}
+	// токен доступа к ссылке не подходит для авторизации
+	_, err = ParseToken(token)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
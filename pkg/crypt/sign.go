@@ -0,0 +1,64 @@
+// Package crypt реализует подпись коротких ссылок с ограниченным сроком действия
+package crypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSignatureInvalid Подпись ссылки отсутствует, повреждена или сделана другим ключом
+	ErrSignatureInvalid = errors.New("неверная подпись ссылки")
+	// ErrSignatureExpired Срок действия подписи ссылки истек
+	ErrSignatureExpired = errors.New("срок действия подписи истек")
+)
+
+// urlMAC Подпись короткой ссылки и срока ее действия ключом secret.
+// Префикс отделяет подписи ссылок от других подписей тем же ключом
+func urlMAC(secret []byte, shortURL string, exp int64) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("short-url\x00" + shortURL + "\x00" + strconv.FormatInt(exp, 10)))
+	return mac.Sum(nil)
+}
+
+// SignURL Подпись короткой ссылки shortURL до момента exp активным ключом.
+// Подпись содержит ID ключа, поэтому остается действительной после смены активного ключа
+func SignURL(shortURL string, exp time.Time) (string, error) {
+	keyID, secret, err := activeKey()
+	if err != nil {
+		return "", err
+	}
+	return keyID + "." + base64.RawURLEncoding.EncodeToString(urlMAC(secret, shortURL, exp.Unix())), nil
+}
+
+// VerifyURL Проверка подписи sig короткой ссылки shortURL со сроком exp в секундах Unix
+func VerifyURL(shortURL, exp, sig string) error {
+	keyID, encoded, ok := strings.Cut(sig, ".")
+	if !ok {
+		return ErrSignatureInvalid
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	secret, err := verifyKey(keyID)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	if !hmac.Equal(mac, urlMAC(secret, shortURL, expires)) {
+		return ErrSignatureInvalid
+	}
+	if time.Now().Unix() >= expires {
+		return ErrSignatureExpired
+	}
+	return nil
+}
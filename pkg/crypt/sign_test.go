@@ -0,0 +1,78 @@
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gerasimovpavel/shortener.git/internal/config"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_SignURL(t *testing.T) {
+	config.Options.PassphraseKey = "sign test key"
+	defer SetKeyring(nil)
+
+	exp := time.Now().Add(time.Hour)
+	sig, err := SignURL("abc", exp)
+	if err != nil {
+		panic(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	expired, err := SignURL("abc", past)
+	if err != nil {
+		panic(err)
+	}
+	unix := strconv.FormatInt(exp.Unix(), 10)
+
+	tests := []struct {
+		name     string
+		shortURL string
+		exp      string
+		sig      string
+		wantErr  error
+	}{
+		{"valid", "abc", unix, sig, nil},
+		{"other link", "xyz", unix, sig, ErrSignatureInvalid},
+		{"extended expiry", "abc", strconv.FormatInt(exp.Unix()+3600, 10), sig, ErrSignatureInvalid},
+		{"expired", "abc", strconv.FormatInt(past.Unix(), 10), expired, ErrSignatureExpired},
+		{"no signature", "abc", unix, "", ErrSignatureInvalid},
+		{"bad expiry", "abc", "tomorrow", sig, ErrSignatureInvalid},
+		{"unknown key", "abc", unix, "k1." + sig[len(LegacyKeyID)+1:], ErrSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyURL(tt.shortURL, tt.exp, tt.sig)
+			if !assert.Equal(t, tt.wantErr == nil, err == nil) || !errors.Is(err, tt.wantErr) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+		})
+	}
+
+	// подпись, сделанная прежним ключом, действует после ротации, пока ключ в наборе
+	path := filepath.Join(t.TempDir(), "keys.json")
+	k, err := ReadKeyring(path)
+	if err != nil {
+		panic(err)
+	}
+	first, err := k.Generate()
+	if err != nil {
+		panic(err)
+	}
+	assert.NoError(t, k.Promote(first.ID))
+	SetKeyring(k)
+	rotated, err := SignURL("abc", exp)
+	if err != nil {
+		panic(err)
+	}
+	second, err := k.Generate()
+	if err != nil {
+		panic(err)
+	}
+	assert.NoError(t, k.Promote(second.ID))
+	assert.NoError(t, VerifyURL("abc", unix, rotated))
+	assert.NoError(t, k.Remove(first.ID))
+	assert.ErrorIs(t, VerifyURL("abc", unix, rotated), ErrSignatureInvalid)
+}
@@ -0,0 +1,26 @@
+// Package logger реализует передачу логгера через контекст запроса
+package logger
+
+import (
+	"context"
+	"go.uber.org/zap"
+)
+
+type ctxKey struct{}
+
+// WithContext Сохранение логгера в контексте
+func WithContext(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext Логгер из контекста. Если в контексте логгера нет,
+// возвращается глобальный Logger
+func FromContext(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok && l != nil {
+		return l
+	}
+	if Logger != nil {
+		return Logger
+	}
+	return zap.NewNop()
+}
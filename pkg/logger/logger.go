@@ -1,18 +1,96 @@
 // Package logger реализует создание логгера
 package logger
 
-import "go.uber.org/zap"
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"time"
+)
 
-// Logger Логгер от zap
+// Logger Логгер от zap. Используется, когда в контексте запроса нет своего логгера
 var Logger *zap.Logger
 
+// Options Настройки логгера
+type Options struct {
+	// Уровень логирования: debug, info, warn, error
+	Level string
+	// Формат: json или console
+	Encoding string
+	// Сэмплирование однотипных записей
+	Sampling bool
+	// Куда писать: stdout, stderr или пути к файлам
+	Outputs []string
+	// Размер файла в мегабайтах для ротации, 0 - без ограничения
+	MaxSize int
+	// Интервал ротации файла, 0 - без ротации по времени
+	RotateInterval time.Duration
+	// Количество хранимых старых файлов, 0 - хранить все
+	MaxBackups int
+}
+
+// DefaultOptions Настройки по умолчанию: info в консольном формате в stderr
+func DefaultOptions() Options {
+	return Options{
+		Level:    "info",
+		Encoding: "console",
+		Outputs:  []string{"stderr"},
+	}
+}
+
 // NewLogger создание нового логгера
-func NewLogger() error {
-	var err error
-	Logger, err = zap.NewDevelopment()
-	defer Logger.Sync()
+func NewLogger(opts Options) (*zap.Logger, error) {
+	level, err := zapcore.ParseLevel(opts.Level)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var encoder zapcore.Encoder
+	switch opts.Encoding {
+	case "json":
+		encoder = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	case "", "console":
+		encCfg := zap.NewDevelopmentEncoderConfig()
+		encCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoder = zapcore.NewConsoleEncoder(encCfg)
+	default:
+		return nil, fmt.Errorf("неизвестный формат лога: %s", opts.Encoding)
+	}
+
+	ws, err := openOutputs(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	core := zapcore.NewCore(encoder, ws, level)
+	if opts.Sampling {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, 100, 100)
+	}
+
+	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)), nil
+}
+
+// openOutputs Открытие всех назначений лога
+func openOutputs(opts Options) (zapcore.WriteSyncer, error) {
+	outputs := opts.Outputs
+	if len(outputs) == 0 {
+		outputs = DefaultOptions().Outputs
+	}
+	syncers := make([]zapcore.WriteSyncer, 0, len(outputs))
+	for _, out := range outputs {
+		switch out {
+		case "stdout":
+			syncers = append(syncers, zapcore.Lock(os.Stdout))
+		case "stderr":
+			syncers = append(syncers, zapcore.Lock(os.Stderr))
+		default:
+			rf, err := NewRotatingFile(out, opts.MaxSize, opts.RotateInterval, opts.MaxBackups)
+			if err != nil {
+				return nil, err
+			}
+			syncers = append(syncers, rf)
+		}
 	}
-	return nil
+	return zapcore.NewMultiWriteSyncer(syncers...), nil
 }
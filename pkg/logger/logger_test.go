@@ -1,10 +1,82 @@
 package logger
 
-import "testing"
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestLogger(t *testing.T) {
-	err := NewLogger()
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"default", DefaultOptions(), false},
+		{"json sampling file", Options{
+			Level:    "debug",
+			Encoding: "json",
+			Sampling: true,
+			Outputs:  []string{"stdout", filepath.Join(dir, "app.log")},
+		}, false},
+		{"wrong level", Options{Level: "loud"}, true},
+		{"wrong encoding", Options{Level: "info", Encoding: "xml"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewLogger(tt.opts)
+			if !assert.Equal(t, tt.wantErr, err != nil) {
+				panic(fmt.Errorf("error expect %v actual %v", tt.wantErr, err))
+			}
+			if err == nil {
+				l.Info("test")
+				l.Sync()
+			}
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+
+	rf, err := NewRotatingFile(path, 0, 0, 2)
+	if err != nil {
+		panic(err)
+	}
+	// ротация по размеру: 1 МБ задать в тесте дорого, поэтому ограничиваем напрямую
+	rf.maxSize = 10
+	for i := 0; i < 5; i++ {
+		_, err = rf.Write([]byte("0123456789"))
+		if err != nil {
+			panic(err)
+		}
+		// имена старых файлов различаются по миллисекундам
+		time.Sleep(2 * time.Millisecond)
+	}
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		panic(err)
+	}
+	assert.Len(t, backups, 2)
+
+	// ротация по времени
+	rf.maxSize = 0
+	rf.interval = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	_, err = rf.Write([]byte("after interval"))
+	if err != nil {
+		panic(err)
+	}
+	b, err := os.ReadFile(path)
 	if err != nil {
 		panic(err)
 	}
+	assert.True(t, strings.HasPrefix(string(b), "after interval"))
+	rf.Close()
 }
@@ -0,0 +1,142 @@
+// Package logger реализует запись лога в файл с ротацией по размеру и времени
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat Формат времени в имени старого файла лога
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotatingFile Файл лога с ротацией по размеру и времени
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// NewRotatingFile Открытие файла лога с ротацией.
+// maxSizeMB - размер в мегабайтах, interval - период ротации, maxBackups - сколько старых файлов хранить.
+// Нулевые значения отключают соответствующее ограничение
+func NewRotatingFile(path string, maxSizeMB int, interval time.Duration, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		interval:   interval,
+		maxBackups: maxBackups,
+	}
+	err := rf.open()
+	if err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// Write Запись в файл с ротацией при необходимости
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.needRotate(int64(len(p))) {
+		err := rf.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Sync Сброс данных на диск
+func (rf *RotatingFile) Sync() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Sync()
+}
+
+// Close Закрытие файла
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
+
+func (rf *RotatingFile) needRotate(n int64) bool {
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+n > rf.maxSize {
+		return true
+	}
+	if rf.interval > 0 && time.Since(rf.openedAt) >= rf.interval {
+		return true
+	}
+	return false
+}
+
+func (rf *RotatingFile) open() error {
+	err := os.MkdirAll(filepath.Dir(rf.path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	rf.openedAt = time.Now()
+	return nil
+}
+
+// rotate Переименование текущего файла и открытие нового
+func (rf *RotatingFile) rotate() error {
+	err := rf.file.Close()
+	if err != nil {
+		return err
+	}
+	backup := rf.path + "." + time.Now().Format(backupTimeFormat)
+	err = os.Rename(rf.path, backup)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = rf.open()
+	if err != nil {
+		return err
+	}
+	return rf.removeOldBackups()
+}
+
+// removeOldBackups Удаление старых файлов сверх maxBackups
+func (rf *RotatingFile) removeOldBackups() error {
+	if rf.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return err
+	}
+	// имена содержат время, поэтому лексикографический порядок совпадает с хронологическим
+	sort.Strings(backups)
+	for len(backups) > rf.maxBackups {
+		err = os.Remove(backups[0])
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}